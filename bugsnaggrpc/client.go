@@ -0,0 +1,86 @@
+package bugsnaggrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/kinbiko/bugsnag"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryClientInterceptor returns a gRPC client interceptor for unary calls
+// that propagates the diagnostic data in the call's context to the server,
+// and reports returned errors with any of the reported status codes.
+// Every completed call is recorded as a breadcrumb, which is included in the
+// error report, and in later error reports if the call's context has a
+// breadcrumb recorder attached (see bugsnag.Notifier.WithBreadcrumbRecorder).
+func UnaryClientInterceptor(n *bugsnag.Notifier, opts ...Option) grpc.UnaryClientInterceptor {
+	i := newInterceptor(n, opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		err := invoker(i.outgoingContext(ctx), method, req, reply, cc, callOpts...)
+		i.report(i.withCallBreadcrumb(ctx, method, err), err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a gRPC client interceptor for streaming
+// calls. It behaves like the UnaryClientInterceptor, additionally reporting
+// the first error received from the stream, if any. The breadcrumb is
+// recorded once the stream completes, i.e. once receiving a message returns
+// an error, including io.EOF, or sending a message returns an error other than
+// io.EOF.
+func StreamClientInterceptor(n *bugsnag.Notifier, opts ...Option) grpc.StreamClientInterceptor {
+	i := newInterceptor(n, opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(i.outgoingContext(ctx), desc, cc, method, callOpts...)
+		if err != nil {
+			i.report(i.withCallBreadcrumb(ctx, method, err), err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, interceptor: i, ctx: ctx, method: method}, nil
+	}
+}
+
+// clientStream records the completion of the wrapped grpc.ClientStream, and
+// reports the first error it returns.
+type clientStream struct {
+	grpc.ClientStream
+	interceptor *interceptor
+	ctx         context.Context //nolint:containedctx // Needed to report errors that happen after the call was started
+	method      string
+	once        sync.Once
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		// io.EOF indicates that the stream completed successfully.
+		s.complete(nil)
+	default:
+		s.complete(err)
+	}
+	return err //nolint:wrapcheck // Callers expect io.EOF and status errors as-is
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	// io.EOF indicates that the stream was ended by the server, in which case
+	// the status of the call is only known once it's received by RecvMsg.
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.complete(err)
+	}
+	return err //nolint:wrapcheck // Callers expect io.EOF and status errors as-is
+}
+
+// complete records the completion of the call with the given error, reporting
+// the error, unless the completion has already been recorded.
+func (s *clientStream) complete(err error) {
+	s.once.Do(func() {
+		s.interceptor.report(s.interceptor.withCallBreadcrumb(s.ctx, s.method, err), err)
+	})
+}
@@ -0,0 +1,21 @@
+module github.com/kinbiko/bugsnag/bugsnaggrpc
+
+go 1.22
+
+// Only used when developing this module alongside the core module, as the
+// replace directives of dependencies are ignored. Consumers get the required
+// version of the core module below.
+replace github.com/kinbiko/bugsnag => ../
+
+require (
+	github.com/kinbiko/bugsnag v0.0.0-20261018175823-f9c179843554
+	google.golang.org/grpc v1.64.0
+)
+
+require (
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
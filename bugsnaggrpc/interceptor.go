@@ -0,0 +1,142 @@
+// Package bugsnaggrpc provides gRPC interceptors for clients and servers that
+// report errors and panics to Bugsnag, and propagate diagnostic data between
+// services.
+//
+// Servers should install both the unary and stream server interceptors:
+//
+//	srv := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(bugsnaggrpc.UnaryServerInterceptor(notifier)),
+//		grpc.ChainStreamInterceptor(bugsnaggrpc.StreamServerInterceptor(notifier)),
+//	)
+//
+// Clients should similarly install the client interceptors:
+//
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithChainUnaryInterceptor(bugsnaggrpc.UnaryClientInterceptor(notifier)),
+//		grpc.WithChainStreamInterceptor(bugsnaggrpc.StreamClientInterceptor(notifier)),
+//	)
+package bugsnaggrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kinbiko/bugsnag"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMetadataKey is the gRPC metadata key that diagnostic data is
+// propagated under, unless overridden with WithMetadataKey.
+const DefaultMetadataKey = "bugsnag-diagnostics"
+
+// Option configures the interceptors in this package.
+type Option func(*interceptor)
+
+// WithReportedCodes overrides which gRPC status codes get reported to
+// Bugsnag. Defaults to codes.Unknown, codes.Internal, and codes.DataLoss, as
+// other codes typically indicate that the request was invalid, rather than
+// that the application is misbehaving.
+// Panics in server handlers are always reported.
+func WithReportedCodes(reportedCodes ...codes.Code) Option {
+	return func(i *interceptor) {
+		i.reportedCodes = map[codes.Code]bool{}
+		for _, code := range reportedCodes {
+			i.reportedCodes[code] = true
+		}
+	}
+}
+
+// WithMetadataKey overrides the gRPC metadata key that diagnostic data is
+// propagated under. Clients and servers must use the same key.
+func WithMetadataKey(key string) Option {
+	return func(i *interceptor) { i.metadataKey = key }
+}
+
+type interceptor struct {
+	notifier      *bugsnag.Notifier
+	reportedCodes map[codes.Code]bool
+	metadataKey   string
+}
+
+func newInterceptor(n *bugsnag.Notifier, opts []Option) *interceptor {
+	i := &interceptor{
+		notifier:      n,
+		reportedCodes: map[codes.Code]bool{codes.Unknown: true, codes.Internal: true, codes.DataLoss: true},
+		metadataKey:   DefaultMetadataKey,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// withCallBreadcrumb records the completion of the given gRPC method call as
+// a breadcrumb. If the given ctx has a breadcrumb recorder attached, the
+// breadcrumb is recorded there, and so appears in any later error report made
+// with a context sharing the recorder, e.g. the context of the caller.
+func (i *interceptor) withCallBreadcrumb(ctx context.Context, method string, err error) context.Context {
+	return i.notifier.WithBreadcrumb(ctx, bugsnag.Breadcrumb{
+		Name: "gRPC call " + method,
+		Type: bugsnag.BCTypeRequest,
+		Metadata: map[string]interface{}{
+			"method": method,
+			"status": status.Code(err).String(),
+		},
+	})
+}
+
+// report notifies Bugsnag of the given error if its status code is one of the
+// reported codes.
+func (i *interceptor) report(ctx context.Context, err error) {
+	if err == nil || !i.reportedCodes[status.Code(err)] {
+		return
+	}
+	// The gRPC context is likely cancelled by the time the notifier makes the
+	// HTTP request to Bugsnag's servers.
+	i.notifier.Notify(context.WithoutCancel(ctx), bugsnag.Wrap(ctx, err))
+}
+
+// recoverPanic reports any panic as an unhandled error, and overwrites the
+// error returned to the client with an Internal status error.
+func (i *interceptor) recoverPanic(ctx context.Context, err *error) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	panicErr, ok := rec.(error)
+	if !ok {
+		panicErr = fmt.Errorf("%v", rec)
+	}
+	i.notifier.Notify(context.WithoutCancel(ctx), bugsnag.Wrap(ctx, panicErr, "panic in gRPC handler", bugsnag.AsUnhandled(), bugsnag.AsPanic()))
+	*err = status.Error(codes.Internal, "panic in gRPC handler")
+}
+
+// incomingContext attaches any diagnostic data and W3C trace context
+// propagated from the client to the given ctx, continues the session of the
+// client or starts a new session, and attaches a breadcrumb recorder for the
+// call.
+func (i *interceptor) incomingContext(ctx context.Context, method string) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(i.metadataKey); len(vals) > 0 {
+			ctx = i.notifier.Deserialize(ctx, []byte(vals[0]), bugsnag.WithMerge())
+		}
+		if vals := md.Get("traceparent"); len(vals) > 0 {
+			ctx = i.notifier.WithTraceParent(ctx, vals[0])
+		}
+	}
+	ctx = i.notifier.ResumeSession(ctx)
+	ctx = i.notifier.WithBreadcrumbRecorder(ctx)
+	return i.notifier.WithBugsnagContext(ctx, method)
+}
+
+// outgoingContext attaches the diagnostic data in the given ctx to the
+// outgoing gRPC metadata.
+func (i *interceptor) outgoingContext(ctx context.Context) context.Context {
+	if data := i.notifier.Serialize(ctx); len(data) > 0 {
+		return metadata.AppendToOutgoingContext(ctx, i.metadataKey, string(data))
+	}
+	return ctx
+}
@@ -0,0 +1,383 @@
+package bugsnaggrpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnaggrpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type reports struct {
+	mu       sync.Mutex
+	payloads []*bugsnag.JSONErrorReport
+}
+
+func (r *reports) get() []*bugsnag.JSONErrorReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.payloads
+}
+
+// makeNotifier returns a notifier that records the error reports it would
+// otherwise have sent to Bugsnag.
+func makeNotifier(t *testing.T) (*bugsnag.Notifier, *reports) {
+	t.Helper()
+	reps := &reports{}
+	n, err := bugsnag.New(bugsnag.Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		AppVersion:   "1.2.3",
+		ReleaseStage: "test",
+		ErrorReportSanitizer: func(_ context.Context, p *bugsnag.JSONErrorReport) error {
+			reps.mu.Lock()
+			defer reps.mu.Unlock()
+			reps.payloads = append(reps.payloads, p)
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+		SessionReportSanitizer: func(_ *bugsnag.JSONSessionReport) error {
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+	return n, reps
+}
+
+// healthServer misbehaves according to the service name in the request, and
+// is healthy for the "healthy" service.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (s *healthServer) Check(_ context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if err := s.misbehave(req.GetService()); err != nil {
+		return nil, err
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(req *grpc_health_v1.HealthCheckRequest, ss grpc_health_v1.Health_WatchServer) error {
+	if err := ss.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}); err != nil {
+		return err
+	}
+	return s.misbehave(req.GetService())
+}
+
+func (s *healthServer) misbehave(service string) error {
+	switch service {
+	case "panic":
+		panic("oh ploppers")
+	case "not found":
+		return status.Error(codes.NotFound, "no such service")
+	case "healthy":
+		return nil
+	default:
+		return errors.New("oh ploppers")
+	}
+}
+
+// uploadDesc describes a client-streaming service that reads a single
+// message before failing, without reading the rest of the client's messages.
+//
+//nolint:gochecknoglobals // Treated as a constant.
+var uploadDesc = grpc.ServiceDesc{
+	ServiceName: "test.Upload",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Upload",
+		ClientStreams: true,
+		Handler: func(_ interface{}, ss grpc.ServerStream) error {
+			if err := ss.RecvMsg(&grpc_health_v1.HealthCheckRequest{}); err != nil {
+				return err
+			}
+			return status.Error(codes.Internal, "oh ploppers")
+		},
+	}},
+}
+
+func dial(t *testing.T, serverOpts []bugsnaggrpc.Option, clientOpts []bugsnaggrpc.Option) (grpc_health_v1.HealthClient, *bugsnag.Notifier, *reports, *reports) {
+	t.Helper()
+	conn, clientNotifier, serverReports, clientReports := dialConn(t, serverOpts, clientOpts)
+	return grpc_health_v1.NewHealthClient(conn), clientNotifier, serverReports, clientReports
+}
+
+func dialConn(t *testing.T, serverOpts []bugsnaggrpc.Option, clientOpts []bugsnaggrpc.Option) (*grpc.ClientConn, *bugsnag.Notifier, *reports, *reports) {
+	t.Helper()
+	serverNotifier, serverReports := makeNotifier(t)
+	clientNotifier, clientReports := makeNotifier(t)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(bugsnaggrpc.UnaryServerInterceptor(serverNotifier, serverOpts...)),
+		grpc.ChainStreamInterceptor(bugsnaggrpc.StreamServerInterceptor(serverNotifier, serverOpts...)),
+	)
+	grpc_health_v1.RegisterHealthServer(srv, &healthServer{})
+	srv.RegisterService(&uploadDesc, nil)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(bugsnaggrpc.UnaryClientInterceptor(clientNotifier, clientOpts...)),
+		grpc.WithChainStreamInterceptor(bugsnaggrpc.StreamClientInterceptor(clientNotifier, clientOpts...)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, clientNotifier, serverReports, clientReports
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("propagates diagnostics and reports errors on both sides", func(t *testing.T) {
+		t.Parallel()
+		client, n, serverReports, clientReports := dial(t, nil, nil)
+		ctx := n.WithUser(context.Background(), bugsnag.User{ID: "123"})
+		ctx = n.StartSession(ctx)
+
+		_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "error"})
+		if got := status.Code(err); got != codes.Unknown {
+			t.Fatalf("expected code Unknown but got %s", got)
+		}
+
+		sReps := serverReports.get()
+		if len(sReps) != 1 {
+			t.Fatalf("expected 1 server report but got %d", len(sReps))
+		}
+		event := sReps[0].Events[0]
+		if exp := "/grpc.health.v1.Health/Check"; event.Context != exp {
+			t.Errorf("expected context '%s' but got '%s'", exp, event.Context)
+		}
+		if event.User == nil || event.User.ID != "123" {
+			t.Errorf("expected the client's user to be propagated but got %+v", event.User)
+		}
+		if event.Session == nil {
+			t.Error("expected a session to be attached but there was none")
+		}
+		assertCallBreadcrumb(t, event, "/grpc.health.v1.Health/Check", "Unknown")
+
+		cReps := clientReports.get()
+		if len(cReps) != 1 {
+			t.Fatalf("expected 1 client report but got %d", len(cReps))
+		}
+		assertCallBreadcrumb(t, cReps[0].Events[0], "/grpc.health.v1.Health/Check", "Unknown")
+		if cSession := cReps[0].Events[0].Session; event.Session != nil && (cSession == nil || cSession.ID != event.Session.ID) {
+			t.Errorf("expected the server to continue the client's session but got %+v and %+v", event.Session, cSession)
+		}
+	})
+
+	t.Run("records successful calls in the caller's breadcrumb recorder", func(t *testing.T) {
+		t.Parallel()
+		client, n, serverReports, clientReports := dial(t, nil, nil)
+		ctx := n.WithBreadcrumbRecorder(context.Background())
+
+		if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "healthy"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(serverReports.get()) + len(clientReports.get()); got != 0 {
+			t.Fatalf("expected no reports but got %d", got)
+		}
+
+		n.Notify(ctx, errors.New("later error"))
+		cReps := clientReports.get()
+		if len(cReps) != 1 {
+			t.Fatalf("expected 1 client report but got %d", len(cReps))
+		}
+		assertCallBreadcrumb(t, cReps[0].Events[0], "/grpc.health.v1.Health/Check", "OK")
+	})
+
+	t.Run("reports panics as unhandled", func(t *testing.T) {
+		t.Parallel()
+		client, _, serverReports, _ := dial(t, nil, nil)
+
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "panic"})
+		if got := status.Code(err); got != codes.Internal {
+			t.Fatalf("expected code Internal but got %s", got)
+		}
+
+		sReps := serverReports.get()
+		if len(sReps) != 1 {
+			t.Fatalf("expected 1 server report but got %d", len(sReps))
+		}
+		if event := sReps[0].Events[0]; !event.Unhandled || event.SeverityReason.Type != "unhandledPanic" {
+			t.Errorf("expected an unhandled panic but got unhandled=%v, severity reason=%s", event.Unhandled, event.SeverityReason.Type)
+		}
+	})
+
+	t.Run("only reports configured codes", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			name       string
+			opts       []bugsnaggrpc.Option
+			expReports int
+		}{
+			{name: "default codes", opts: nil, expReports: 0},
+			{name: "custom codes", opts: []bugsnaggrpc.Option{bugsnaggrpc.WithReportedCodes(codes.NotFound)}, expReports: 1},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				client, _, serverReports, clientReports := dial(t, tc.opts, tc.opts)
+
+				_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "not found"})
+				if got := status.Code(err); got != codes.NotFound {
+					t.Fatalf("expected code NotFound but got %s", got)
+				}
+				if got := len(serverReports.get()); got != tc.expReports {
+					t.Errorf("expected %d server reports but got %d", tc.expReports, got)
+				}
+				if got := len(clientReports.get()); got != tc.expReports {
+					t.Errorf("expected %d client reports but got %d", tc.expReports, got)
+				}
+			})
+		}
+	})
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("propagates diagnostics and reports errors on both sides", func(t *testing.T) {
+		t.Parallel()
+		client, n, serverReports, clientReports := dial(t, nil, nil)
+		ctx := n.WithUser(context.Background(), bugsnag.User{ID: "123"})
+
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: "error"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("expected first message to be received but got %v", err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != codes.Unknown {
+			t.Fatalf("expected code Unknown but got %v", err)
+		}
+
+		sReps := serverReports.get()
+		if len(sReps) != 1 {
+			t.Fatalf("expected 1 server report but got %d", len(sReps))
+		}
+		event := sReps[0].Events[0]
+		if exp := "/grpc.health.v1.Health/Watch"; event.Context != exp {
+			t.Errorf("expected context '%s' but got '%s'", exp, event.Context)
+		}
+		if event.User == nil || event.User.ID != "123" {
+			t.Errorf("expected the client's user to be propagated but got %+v", event.User)
+		}
+		assertCallBreadcrumb(t, event, "/grpc.health.v1.Health/Watch", "Unknown")
+
+		cReps := clientReports.get()
+		if len(cReps) != 1 {
+			t.Fatalf("expected 1 client report but got %d", len(cReps))
+		}
+		assertCallBreadcrumb(t, cReps[0].Events[0], "/grpc.health.v1.Health/Watch", "Unknown")
+	})
+
+	t.Run("records successful calls in the caller's breadcrumb recorder", func(t *testing.T) {
+		t.Parallel()
+		client, n, serverReports, clientReports := dial(t, nil, nil)
+		ctx := n.WithBreadcrumbRecorder(context.Background())
+
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: "healthy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("expected first message to be received but got %v", err)
+		}
+		if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected the stream to complete but got %v", err)
+		}
+		if got := len(serverReports.get()) + len(clientReports.get()); got != 0 {
+			t.Fatalf("expected no reports but got %d", got)
+		}
+
+		n.Notify(ctx, errors.New("later error"))
+		cReps := clientReports.get()
+		if len(cReps) != 1 {
+			t.Fatalf("expected 1 client report but got %d", len(cReps))
+		}
+		assertCallBreadcrumb(t, cReps[0].Events[0], "/grpc.health.v1.Health/Watch", "OK")
+	})
+
+	t.Run("reports errors of client streams ended by the server", func(t *testing.T) {
+		t.Parallel()
+		conn, _, serverReports, clientReports := dialConn(t, nil, nil)
+
+		stream, err := conn.NewStream(context.Background(), &uploadDesc.Streams[0], "/test.Upload/Upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Send until the stream has been ended by the server.
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			err := stream.SendMsg(&grpc_health_v1.HealthCheckRequest{Service: "chunk"})
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil || time.Now().After(deadline) {
+				t.Fatalf("expected the server to end the stream but got %v", err)
+			}
+		}
+		if err := stream.RecvMsg(&grpc_health_v1.HealthCheckResponse{}); status.Code(err) != codes.Internal {
+			t.Fatalf("expected code Internal but got %v", err)
+		}
+
+		if got := len(serverReports.get()); got != 1 {
+			t.Errorf("expected 1 server report but got %d", got)
+		}
+		cReps := clientReports.get()
+		if len(cReps) != 1 {
+			t.Fatalf("expected 1 client report but got %d", len(cReps))
+		}
+		assertCallBreadcrumb(t, cReps[0].Events[0], "/test.Upload/Upload", "Internal")
+	})
+
+	t.Run("reports panics as unhandled", func(t *testing.T) {
+		t.Parallel()
+		client, _, serverReports, _ := dial(t, nil, nil)
+
+		stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "panic"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = stream.Recv()
+		if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+			t.Fatalf("expected code Internal but got %v", err)
+		}
+
+		sReps := serverReports.get()
+		if len(sReps) != 1 {
+			t.Fatalf("expected 1 server report but got %d", len(sReps))
+		}
+		if event := sReps[0].Events[0]; !event.Unhandled {
+			t.Error("expected an unhandled event")
+		}
+	})
+}
+
+func assertCallBreadcrumb(t *testing.T, event *bugsnag.JSONEvent, method, code string) {
+	t.Helper()
+	if len(event.Breadcrumbs) == 0 {
+		t.Fatal("expected breadcrumbs but got none")
+	}
+	bc := event.Breadcrumbs[0]
+	if bc.Type != "request" || bc.Metadata["method"] != method || bc.Metadata["status"] != code {
+		t.Errorf("expected request breadcrumb for %s with status %s but got %+v", method, code, bc)
+	}
+}
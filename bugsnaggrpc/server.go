@@ -0,0 +1,59 @@
+package bugsnaggrpc
+
+import (
+	"context"
+
+	"github.com/kinbiko/bugsnag"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor returns a gRPC server interceptor for unary calls
+// that:
+//
+//   - merges diagnostic data propagated by the client interceptors into the
+//     diagnostic data already attached to the context,
+//   - attaches the trace of any W3C traceparent metadata with WithTraceParent,
+//   - continues the Bugsnag session of the client, or starts a new session,
+//   - attaches a breadcrumb recorder,
+//   - sets the Bugsnag context to the full gRPC method name,
+//   - reports panics as unhandled errors, responding with codes.Internal,
+//   - records the completed call as a breadcrumb,
+//   - reports returned errors with any of the reported status codes.
+func UnaryServerInterceptor(n *bugsnag.Notifier, opts ...Option) grpc.UnaryServerInterceptor {
+	i := newInterceptor(n, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		ctx = i.incomingContext(ctx, info.FullMethod)
+		defer i.recoverPanic(ctx, &err)
+
+		res, err = handler(ctx, req)
+		i.report(i.withCallBreadcrumb(ctx, info.FullMethod, err), err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC server interceptor for streaming
+// calls. It behaves like the UnaryServerInterceptor, with the diagnostic data
+// being available through the Context method of the grpc.ServerStream given
+// to the handler.
+func StreamServerInterceptor(n *bugsnag.Notifier, opts ...Option) grpc.StreamServerInterceptor {
+	i := newInterceptor(n, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := i.incomingContext(ss.Context(), info.FullMethod)
+		defer i.recoverPanic(ctx, &err)
+
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		i.report(i.withCallBreadcrumb(ctx, info.FullMethod, err), err)
+		return err
+	}
+}
+
+// serverStream overrides the context of the wrapped grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context //nolint:containedctx // The grpc.ServerStream interface requires us to store it
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,151 @@
+// Package bugsnaghttp provides net/http middleware that reports panics (and
+// optionally 5xx responses) to Bugsnag, and tracks a session per request.
+//
+//	mux := http.NewServeMux()
+//	// ... register your handlers ...
+//	http.ListenAndServe(":8080", bugsnaghttp.Middleware(notifier)(mux))
+package bugsnaghttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/kinbiko/bugsnag"
+)
+
+// Option configures the middleware returned from Middleware.
+type Option func(*middleware)
+
+// WithRoute overrides how the Bugsnag context (shown as the "Context" of the
+// error in the dashboard) is derived from the request. Defaults to the HTTP
+// method and the URL path, e.g. "GET /users/123".
+// The route is derived before the wrapped handler is called, so if the
+// middleware wraps a router such as http.ServeMux, the request hasn't been
+// matched to a route pattern yet. To avoid high cardinality contexts, either
+// normalize the path, e.g. by returning "GET /users/{id}" for the above, or
+// wrap the handler of each route with its own middleware instead.
+func WithRoute(route func(r *http.Request) string) Option {
+	return func(m *middleware) { m.route = route }
+}
+
+// WithServerErrorReporting makes the middleware report any response with a
+// 5xx status code to Bugsnag as a handled error.
+func WithServerErrorReporting() Option {
+	return func(m *middleware) { m.reportServerErrors = true }
+}
+
+type middleware struct {
+	notifier           *bugsnag.Notifier
+	route              func(r *http.Request) string
+	reportServerErrors bool
+}
+
+// Middleware returns a function that wraps a http.Handler such that each
+// request:
+//
+//   - starts a new Bugsnag session,
+//   - has a breadcrumb recorder attached with WithBreadcrumbRecorder,
+//   - has its request data attached with WithRequest,
+//   - has the trace of its traceparent header attached with WithTraceParent,
+//   - has its Bugsnag context set to the route of the request, see WithRoute,
+//   - reports any panics as unhandled errors, and responds with a 500 status
+//     code if no response has been written yet.
+//
+// The context.Context given to the wrapped handler contains all of the above
+// diagnostic data, so you should pass it to any Notify or Wrap calls.
+func Middleware(n *bugsnag.Notifier, opts ...Option) func(http.Handler) http.Handler {
+	m := &middleware{
+		notifier: n,
+		route:    func(r *http.Request) string { return r.Method + " " + r.URL.Path },
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m.wrap
+}
+
+func (m *middleware) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := m.notifier.StartSession(r.Context())
+		ctx = m.notifier.WithBreadcrumbRecorder(ctx)
+		ctx = m.notifier.WithRequest(ctx, r)
+		ctx = m.notifier.WithTraceParent(ctx, r.Header.Get("traceparent"))
+		ctx = m.notifier.WithBugsnagContext(ctx, m.route(r))
+
+		rw := &responseWriter{ResponseWriter: w}
+		defer m.recoverPanic(ctx, rw)
+
+		h.ServeHTTP(rw, r.WithContext(ctx))
+
+		if m.reportServerErrors && rw.status >= http.StatusInternalServerError {
+			err := fmt.Errorf("server responded with status %d (%s)", rw.status, http.StatusText(rw.status))
+			// The request context is likely cancelled by the time the
+			// notifier makes the HTTP request to Bugsnag's servers.
+			m.notifier.Notify(context.WithoutCancel(ctx), bugsnag.Wrap(ctx, err))
+		}
+	})
+}
+
+func (m *middleware) recoverPanic(ctx context.Context, rw *responseWriter) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		// This panic is the conventional way of aborting a response, and
+		// should be handled by the net/http server as usual.
+		panic(rec)
+	}
+
+	err, ok := rec.(error)
+	if !ok {
+		err = fmt.Errorf("%v", rec)
+	}
+	m.notifier.Notify(context.WithoutCancel(ctx), bugsnag.Wrap(ctx, err, "panic in HTTP handler", bugsnag.AsUnhandled(), bugsnag.AsPanic()))
+
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// responseWriter keeps track of the status code written by the wrapped
+// handler.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.ResponseWriter.Write(b) //nolint:wrapcheck // Handlers expect the errors of the underlying writer
+}
+
+// Unwrap allows http.ResponseController to access the underlying
+// http.ResponseWriter, e.g. in order to flush or hijack the connection.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush implements http.Flusher, as many handlers check for this interface
+// directly rather than going through http.ResponseController.
+func (rw *responseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker, as e.g. websocket libraries check for this
+// interface directly rather than going through http.ResponseController.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack() //nolint:wrapcheck // Handlers expect the errors of the underlying writer
+}
@@ -0,0 +1,174 @@
+package bugsnaghttp_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnaghttp"
+	"github.com/kinbiko/bugsnag/internal/bugsnagtest"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("attaches diagnostic data to the handler's context", func(t *testing.T) {
+		t.Parallel()
+		n, reps := bugsnagtest.NewNotifier(t)
+		h := bugsnaghttp.Middleware(n)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n.Notify(r.Context(), errors.New("oops"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/pokemon/25", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		h.ServeHTTP(rec, req)
+
+		if got, exp := rec.Code, http.StatusNoContent; got != exp {
+			t.Errorf("expected status %d but got %d", exp, got)
+		}
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		event := got[0].Events[0]
+		if exp := "GET /pokemon/25"; event.Context != exp {
+			t.Errorf("expected context '%s' but got '%s'", exp, event.Context)
+		}
+		if event.Session == nil {
+			t.Error("expected a session to be attached but there was none")
+		}
+		if event.Request == nil || event.Request.URL != "http://example.com/pokemon/25" {
+			t.Errorf("expected request data to be attached but got %+v", event.Request)
+		}
+		if event.Correlation == nil || event.Correlation.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected the trace to be attached but got %+v", event.Correlation)
+		}
+	})
+
+	t.Run("reports panics as unhandled errors", func(t *testing.T) {
+		t.Parallel()
+		n, reps := bugsnagtest.NewNotifier(t)
+		h := bugsnaghttp.Middleware(n, bugsnaghttp.WithRoute(func(_ *http.Request) string { return "pokemon" }))(
+			http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				// Note: the returned ctx is discarded, as is often the case
+				// for breadcrumbs added deep in the call stack.
+				n.WithBreadcrumb(r.Context(), bugsnag.Breadcrumb{Name: "about to panic"})
+				panic("oh ploppers")
+			}),
+		)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pokemon/25", nil))
+
+		if got, exp := rec.Code, http.StatusInternalServerError; got != exp {
+			t.Errorf("expected status %d but got %d", exp, got)
+		}
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		event := got[0].Events[0]
+		if !event.Unhandled {
+			t.Error("expected the event to be unhandled")
+		}
+		if exp := "unhandledPanic"; event.SeverityReason.Type != exp {
+			t.Errorf("expected severity reason '%s' but got '%s'", exp, event.SeverityReason.Type)
+		}
+		if exp := "pokemon"; event.Context != exp {
+			t.Errorf("expected context '%s' but got '%s'", exp, event.Context)
+		}
+		if exp := "panic in HTTP handler: oh ploppers"; event.Exceptions[0].Message != exp {
+			t.Errorf("expected message '%s' but got '%s'", exp, event.Exceptions[0].Message)
+		}
+		if len(event.Breadcrumbs) != 1 || event.Breadcrumbs[0].Name != "about to panic" {
+			t.Errorf("expected the breadcrumb added in the handler to be reported but got %+v", event.Breadcrumbs)
+		}
+	})
+
+	t.Run("supports hijacking the connection", func(t *testing.T) {
+		t.Parallel()
+		n, _ := bugsnagtest.NewNotifier(t)
+		srv := httptest.NewServer(bugsnaghttp.Middleware(n)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				t.Error("expected the response writer to implement http.Hijacker")
+				return
+			}
+			conn, buf, err := hj.Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			_, _ = buf.WriteString("HTTP/1.1 418 I'm a teapot\r\nContent-Length: 0\r\n\r\n")
+			_ = buf.Flush()
+		})))
+		t.Cleanup(srv.Close)
+
+		res, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if got, exp := res.StatusCode, http.StatusTeapot; got != exp {
+			t.Errorf("expected status %d but got %d", exp, got)
+		}
+	})
+
+	t.Run("re-panics on http.ErrAbortHandler", func(t *testing.T) {
+		t.Parallel()
+		n, reps := bugsnagtest.NewNotifier(t)
+		h := bugsnaghttp.Middleware(n)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler { //nolint:errorlint // sentinel panic value
+				t.Errorf("expected http.ErrAbortHandler panic but got %v", r)
+			}
+			if got := len(reps.Get()); got != 0 {
+				t.Errorf("expected no reports but got %d", got)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	t.Run("server errors", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			name       string
+			opts       []bugsnaghttp.Option
+			status     int
+			expReports int
+		}{
+			{name: "not reported by default", opts: nil, status: http.StatusBadGateway, expReports: 0},
+			{name: "reported when enabled", opts: []bugsnaghttp.Option{bugsnaghttp.WithServerErrorReporting()}, status: http.StatusBadGateway, expReports: 1},
+			{name: "client errors never reported", opts: []bugsnaghttp.Option{bugsnaghttp.WithServerErrorReporting()}, status: http.StatusNotFound, expReports: 0},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				n, reps := bugsnagtest.NewNotifier(t)
+				h := bugsnaghttp.Middleware(n, tc.opts...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(tc.status)
+				}))
+
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+				got := reps.Get()
+				if len(got) != tc.expReports {
+					t.Fatalf("expected %d reports but got %d", tc.expReports, len(got))
+				}
+				if tc.expReports == 0 {
+					return
+				}
+				if exp, msg := "server responded with status 502 (Bad Gateway)", got[0].Events[0].Exceptions[0].Message; msg != exp {
+					t.Errorf("expected message '%s' but got '%s'", exp, msg)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,23 @@
+module github.com/kinbiko/bugsnag/bugsnagotel
+
+go 1.22
+
+// Only used when developing this module alongside the core module, as the
+// replace directives of dependencies are ignored. Consumers get the required
+// version of the core module below.
+replace github.com/kinbiko/bugsnag => ../
+
+require (
+	github.com/kinbiko/bugsnag v0.0.0-20261018175823-f9c179843554
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
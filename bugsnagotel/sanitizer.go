@@ -0,0 +1,138 @@
+// Package bugsnagotel bridges Bugsnag error reports and OpenTelemetry traces.
+//
+// Install the ErrorReportSanitizer in order to record reports as exception
+// events on the span active in the context of the report, and to attach the
+// attributes of the span to the report as metadata, and install the
+// TraceExtractor in order to correlate reports with their traces:
+//
+//	n, err := bugsnag.New(bugsnag.Configuration{
+//		// ...
+//		ErrorReportSanitizer: bugsnagotel.ErrorReportSanitizer(nil),
+//		TraceExtractor:       bugsnagotel.TraceExtractor,
+//	})
+package bugsnagotel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kinbiko/bugsnag"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTab is the metadata tab that span attributes are attached under,
+// unless overridden with WithTab.
+const DefaultTab = "span"
+
+// Option configures the ErrorReportSanitizer.
+type Option func(*sanitizer)
+
+// WithTab overrides the metadata tab that span attributes are attached under.
+func WithTab(tab string) Option {
+	return func(s *sanitizer) { s.tab = tab }
+}
+
+type sanitizer struct {
+	next bugsnag.ErrorReportSanitizer
+	tab  string
+}
+
+// ErrorReportSanitizer returns a bugsnag.ErrorReportSanitizer that, for the
+// span active in the context of each error report:
+//
+//   - attaches the attributes of the span to the report as metadata, if the
+//     span exposes its attributes, as spans from the OpenTelemetry SDK do,
+//   - records the reported error as an exception event on the span,
+//   - sets the status of the span to codes.Error if the report is unhandled.
+//
+// The given next sanitizer, if not nil, is invoked afterwards, such that it
+// may amend or discard the report as usual.
+// Reports that are later discarded by next are still recorded on the span.
+func ErrorReportSanitizer(next bugsnag.ErrorReportSanitizer, opts ...Option) bugsnag.ErrorReportSanitizer {
+	s := &sanitizer{next: next, tab: DefaultTab}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s.sanitize
+}
+
+func (s *sanitizer) sanitize(ctx context.Context, report *bugsnag.JSONErrorReport) error {
+	span := trace.SpanFromContext(ctx)
+	for _, event := range report.Events {
+		s.attachAttributes(span, event)
+		recordEvent(span, event)
+	}
+	if s.next == nil {
+		return nil
+	}
+	return s.next(ctx, report)
+}
+
+// attachAttributes attaches the attributes of the given span to the metadata
+// of the given event, if the span exposes its attributes.
+func (s *sanitizer) attachAttributes(span trace.Span, event *bugsnag.JSONEvent) {
+	ro, ok := span.(interface{ Attributes() []attribute.KeyValue })
+	if !ok {
+		return
+	}
+	attrs := ro.Attributes()
+	if len(attrs) == 0 {
+		return
+	}
+	if event.Metadata == nil {
+		event.Metadata = map[string]map[string]interface{}{}
+	}
+	if event.Metadata[s.tab] == nil {
+		event.Metadata[s.tab] = map[string]interface{}{}
+	}
+	for _, attr := range attrs {
+		event.Metadata[s.tab][string(attr.Key)] = attr.Value.AsInterface()
+	}
+}
+
+// recordEvent records the given event as an exception event on the given
+// span, following the OpenTelemetry semantic conventions for exceptions.
+// Only the first exception of the event is recorded, as this is the error
+// that was reported, and the rest are the errors it wraps.
+func recordEvent(span trace.Span, event *bugsnag.JSONEvent) {
+	if !span.IsRecording() || len(event.Exceptions) == 0 {
+		return
+	}
+	ex := event.Exceptions[0]
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionType(ex.ErrorClass),
+		semconv.ExceptionMessage(ex.Message),
+		semconv.ExceptionStacktrace(makeStacktrace(ex.Stacktrace)),
+		semconv.ExceptionEscaped(event.Unhandled),
+		attribute.String("bugsnag.severity", event.Severity),
+		attribute.String("bugsnag.context", event.Context),
+	))
+	if event.Unhandled {
+		span.SetStatus(codes.Error, ex.Message)
+	}
+}
+
+// makeStacktrace formats the given stackframes in the style of
+// runtime/debug.Stack.
+func makeStacktrace(frames []*bugsnag.JSONStackframe) string {
+	var b strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Method, f.File, f.LineNumber)
+	}
+	return b.String()
+}
+
+// TraceExtractor is a bugsnag.TraceExtractor that returns the IDs of the span
+// active in the given ctx.
+func TraceExtractor(ctx context.Context) (traceID, spanID string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
@@ -0,0 +1,156 @@
+package bugsnagotel_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnagotel"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type reports struct {
+	mu       sync.Mutex
+	payloads []*bugsnag.JSONErrorReport
+}
+
+func (r *reports) get() []*bugsnag.JSONErrorReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.payloads
+}
+
+// makeNotifier returns a notifier that records the error reports it would
+// otherwise have sent to Bugsnag, and a tracer that records its spans in the
+// returned exporter.
+func makeNotifier(t *testing.T, opts ...bugsnagotel.Option) (*bugsnag.Notifier, *reports, trace.Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	reps := &reports{}
+	n, err := bugsnag.New(bugsnag.Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		AppVersion:   "1.2.3",
+		ReleaseStage: "test",
+		ErrorReportSanitizer: bugsnagotel.ErrorReportSanitizer(func(_ context.Context, p *bugsnag.JSONErrorReport) error {
+			reps.mu.Lock()
+			defer reps.mu.Unlock()
+			reps.payloads = append(reps.payloads, p)
+			return errors.New("prevents sending the payload to Bugsnag")
+		}, opts...),
+		TraceExtractor: bugsnagotel.TraceExtractor,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return n, reps, tp.Tracer("bugsnagotel_test"), exporter
+}
+
+func TestErrorReportSanitizer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("records handled errors on the span", func(t *testing.T) {
+		t.Parallel()
+		n, reps, tracer, exporter := makeNotifier(t)
+		ctx, span := tracer.Start(context.Background(), "charge", trace.WithAttributes(
+			attribute.String("payment.provider", "stripe"),
+			attribute.Int("payment.amount", 42),
+		))
+		n.Notify(ctx, n.Wrap(ctx, errors.New("card declined"), "unable to charge card"))
+		span.End()
+
+		got := reps.get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		event := got[0].Events[0]
+		if md := event.Metadata[bugsnagotel.DefaultTab]; md["payment.provider"] != "stripe" || md["payment.amount"] != int64(42) {
+			t.Errorf("expected span attributes as metadata but got %v", md)
+		}
+		sc := span.SpanContext()
+		if c := event.Correlation; c == nil || c.TraceID != sc.TraceID().String() || c.SpanID != sc.SpanID().String() {
+			t.Errorf("expected the report to be correlated with the span but got %+v", c)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span but got %d", len(spans))
+		}
+		if got := spans[0].Status.Code; got != codes.Unset {
+			t.Errorf("expected the status of the span to be left unset for handled errors but got %s", got)
+		}
+		if len(spans[0].Events) != 1 {
+			t.Fatalf("expected 1 span event but got %d", len(spans[0].Events))
+		}
+		spanEvent := spans[0].Events[0]
+		if spanEvent.Name != "exception" {
+			t.Errorf("expected an exception event but got '%s'", spanEvent.Name)
+		}
+		attrs := attribute.NewSet(spanEvent.Attributes...)
+		for key, exp := range map[attribute.Key]interface{}{
+			"exception.type":    "*bugsnag.Error",
+			"exception.message": "unable to charge card: card declined",
+			"exception.escaped": false,
+			"bugsnag.severity":  "warning",
+		} {
+			if got, _ := attrs.Value(key); got.AsInterface() != exp {
+				t.Errorf("expected %s to be '%v' but got '%v'", key, exp, got.AsInterface())
+			}
+		}
+		if got, _ := attrs.Value("exception.stacktrace"); got.AsString() == "" {
+			t.Error("expected a stacktrace but got none")
+		}
+	})
+
+	t.Run("sets the span status for unhandled errors", func(t *testing.T) {
+		t.Parallel()
+		n, _, tracer, exporter := makeNotifier(t)
+		ctx, span := tracer.Start(context.Background(), "handler")
+		n.Notify(ctx, n.Wrap(ctx, errors.New("oops"), "panic in handler", bugsnag.AsUnhandled(), bugsnag.AsPanic()))
+		span.End()
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span but got %d", len(spans))
+		}
+		if got := spans[0].Status; got.Code != codes.Error || got.Description != "panic in handler: oops" {
+			t.Errorf("expected an error status but got %+v", got)
+		}
+	})
+
+	t.Run("custom tab", func(t *testing.T) {
+		t.Parallel()
+		n, reps, tracer, _ := makeNotifier(t, bugsnagotel.WithTab("otel"))
+		ctx, span := tracer.Start(context.Background(), "handler", trace.WithAttributes(attribute.Bool("retry", true)))
+		defer span.End()
+		n.Notify(ctx, errors.New("oops"))
+
+		if got := reps.get()[0].Events[0].Metadata["otel"]["retry"]; got != true {
+			t.Errorf("expected span attributes under the custom tab but got %v", got)
+		}
+	})
+
+	t.Run("no span", func(t *testing.T) {
+		t.Parallel()
+		n, reps, _, _ := makeNotifier(t)
+		n.Notify(context.Background(), errors.New("oops"))
+
+		got := reps.get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		if event := got[0].Events[0]; event.Metadata[bugsnagotel.DefaultTab] != nil || event.Correlation != nil {
+			t.Errorf("expected no span data but got %v and %+v", event.Metadata, event.Correlation)
+		}
+	})
+}
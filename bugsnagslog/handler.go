@@ -0,0 +1,227 @@
+// Package bugsnagslog provides a log/slog handler that records logs as
+// Bugsnag breadcrumbs, and reports error logs to Bugsnag.
+//
+//	logger := slog.New(bugsnagslog.NewHandler(notifier, slog.NewJSONHandler(os.Stdout, nil)))
+//	logger.ErrorContext(ctx, "unable to charge card", "err", err, slog.Group("payment", "id", paymentID))
+package bugsnagslog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/kinbiko/bugsnag"
+)
+
+// DefaultTab is the metadata tab that attributes outside of any group are
+// reported under.
+const DefaultTab = "log"
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithBreadcrumbLevel sets the minimum level of records that are recorded as
+// breadcrumbs. Defaults to slog.LevelInfo.
+func WithBreadcrumbLevel(level slog.Leveler) Option {
+	return func(h *Handler) { h.breadcrumbLevel = level }
+}
+
+// WithNotifyLevel sets the minimum level of records that are reported to
+// Bugsnag. Defaults to slog.LevelError. Records with an error attribute are
+// reported regardless of level, as long as they're at or above the
+// breadcrumb level.
+func WithNotifyLevel(level slog.Leveler) Option {
+	return func(h *Handler) { h.notifyLevel = level }
+}
+
+// Handler is a slog.Handler that records each log record as a breadcrumb,
+// and reports error logs to Bugsnag, before passing the record on to the
+// wrapped slog.Handler.
+//
+// Records at or above the notify level, or with an attribute whose value is
+// an error, are reported with Notify, with a severity based on the level of
+// the record. Attributes are reported as metadata, where attributes inside a
+// group are shown in a tab with the name of the (outermost) group, and any
+// other attributes are shown in the DefaultTab.
+//
+// Breadcrumbs are attached to the context.Context given to the logger. As
+// contexts are immutable, you should attach a breadcrumb recorder with
+// WithBreadcrumbRecorder (e.g. per request) to have these breadcrumbs show up
+// in all error reports made with the same context, and not just the ones made
+// from this Handler.
+type Handler struct {
+	notifier        *bugsnag.Notifier
+	next            slog.Handler
+	breadcrumbLevel slog.Leveler
+	notifyLevel     slog.Leveler
+
+	// attrs are the attributes added with WithAttrs, along with the groups
+	// that were open when they were added.
+	attrs  []groupedAttr
+	groups []string
+}
+
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// NewHandler returns a Handler that wraps next, which will continue to
+// receive all records as usual.
+func NewHandler(n *bugsnag.Notifier, next slog.Handler, opts ...Option) *Handler {
+	h := &Handler{
+		notifier:        n,
+		next:            next,
+		breadcrumbLevel: slog.LevelInfo,
+		notifyLevel:     slog.LevelError,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Enabled reports whether either this Handler or the wrapped handler handles
+// records at the given level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.breadcrumbLevel.Level() || h.next.Enabled(ctx, level)
+}
+
+// Handle records the given record as a breadcrumb, reports it to Bugsnag if
+// applicable, and passes it on to the wrapped handler.
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error { //nolint:gocritic // The slog.Handler interface passes records by value
+	if record.Level >= h.breadcrumbLevel.Level() {
+		h.process(ctx, record)
+	}
+	if !h.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, record) //nolint:wrapcheck // Errors from the wrapped handler are returned as-is
+}
+
+// WithAttrs returns a new Handler whose records include the given attrs.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := h.clone()
+	clone.next = h.next.WithAttrs(attrs)
+	for _, attr := range attrs {
+		clone.attrs = append(clone.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+	return clone
+}
+
+// WithGroup returns a new Handler where any further attributes are nested
+// in a group of the given name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := h.clone()
+	clone.next = h.next.WithGroup(name)
+	clone.groups = append(slices.Clip(h.groups), name)
+	return clone
+}
+
+func (h *Handler) clone() *Handler {
+	clone := *h
+	clone.attrs = slices.Clip(h.attrs)
+	clone.groups = slices.Clip(h.groups)
+	return &clone
+}
+
+func (h *Handler) process(ctx context.Context, record slog.Record) { //nolint:gocritic // The slog.Handler interface passes records by value
+	var (
+		err      error
+		metadata = map[string]map[string]interface{}{}
+		bcMD     = map[string]interface{}{"level": record.Level.String()}
+	)
+	add := func(groups []string, attr slog.Attr) {
+		if e, ok := attr.Value.Resolve().Any().(error); ok && err == nil {
+			err = e
+			return
+		}
+		flatten(groups, attr, func(groups []string, key string, val interface{}) {
+			tab := DefaultTab
+			if len(groups) > 0 {
+				tab, groups = groups[0], groups[1:]
+			}
+			key = strings.Join(append(slices.Clip(groups), key), ".")
+			if metadata[tab] == nil {
+				metadata[tab] = map[string]interface{}{}
+			}
+			metadata[tab][key] = val
+			if tab != DefaultTab {
+				key = tab + "." + key
+			}
+			bcMD[key] = val
+		})
+	}
+	for _, ga := range h.attrs {
+		add(ga.groups, ga.attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		add(h.groups, attr)
+		return true
+	})
+
+	ctx = h.notifier.WithBreadcrumb(ctx, bugsnag.Breadcrumb{
+		Name:      record.Message,
+		Type:      bugsnag.BCTypeLog,
+		Metadata:  bcMD,
+		Timestamp: record.Time,
+	})
+
+	if err == nil && record.Level < h.notifyLevel.Level() {
+		return
+	}
+	if err == nil {
+		err = errors.New(record.Message)
+	}
+	for tab, data := range metadata {
+		for key, val := range data {
+			ctx = h.notifier.WithMetadatum(ctx, tab, key, val)
+		}
+	}
+	msgAndOpts := []interface{}{bugsnag.WithSeverity(severity(record.Level)), bugsnag.WithSeverityReason("log")}
+	if err.Error() != record.Message {
+		msgAndOpts = append(msgAndOpts, "%s", record.Message)
+	}
+	h.notifier.Notify(ctx, bugsnag.Wrap(ctx, err, msgAndOpts...))
+}
+
+// flatten invokes fn for each non-group attribute nested within attr, along
+// with the groups the attribute is nested in.
+func flatten(groups []string, attr slog.Attr, fn func(groups []string, key string, val interface{})) {
+	val := attr.Value.Resolve()
+	if val.Kind() != slog.KindGroup {
+		if attr.Key == "" {
+			return
+		}
+		v := val.Any()
+		if e, ok := v.(error); ok {
+			v = e.Error() // Most error types would otherwise be serialized as {}
+		}
+		fn(groups, attr.Key, v)
+		return
+	}
+	// Per the slog.Handler contract, attributes of groups without a key are
+	// inlined into the current group.
+	if attr.Key != "" {
+		groups = append(slices.Clip(groups), attr.Key)
+	}
+	for _, a := range val.Group() {
+		flatten(groups, a, fn)
+	}
+}
+
+func severity(level slog.Level) bugsnag.Severity {
+	switch {
+	case level >= slog.LevelError:
+		return bugsnag.SeverityError
+	case level >= slog.LevelWarn:
+		return bugsnag.SeverityWarning
+	default:
+		return bugsnag.SeverityInfo
+	}
+}
@@ -0,0 +1,130 @@
+package bugsnagslog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnagslog"
+	"github.com/kinbiko/bugsnag/internal/bugsnagtest"
+
+	"github.com/kinbiko/jsonassert"
+)
+
+// makeLogger returns a logger that writes to the returned buffer, and a
+// record of the error reports that would otherwise have been sent to Bugsnag.
+func makeLogger(t *testing.T, opts ...bugsnagslog.Option) (*slog.Logger, *bugsnag.Notifier, *bytes.Buffer, *bugsnagtest.Reports) {
+	t.Helper()
+	n, reps := bugsnagtest.NewNotifier(t)
+	buf := &bytes.Buffer{}
+	next := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})
+	return slog.New(bugsnagslog.NewHandler(n, next, opts...)), n, buf, reps
+}
+
+func asJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports error logs with metadata and breadcrumbs", func(t *testing.T) {
+		t.Parallel()
+		logger, n, buf, reps := makeLogger(t)
+		ctx := n.WithBugsnagContext(context.Background(), "checkout")
+
+		logger = logger.With("requestID", "abc").WithGroup("payment").With("provider", "stripe")
+		logger.ErrorContext(ctx, "unable to charge card",
+			"err", errors.New("card declined"),
+			"amount", 42,
+			slog.Group("card", "brand", "visa"),
+		)
+
+		if got := buf.String(); !strings.Contains(got, "unable to charge card") {
+			t.Errorf("expected the wrapped handler to receive the record but got: %s", got)
+		}
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		event := got[0].Events[0]
+		if exp := "checkout"; event.Context != exp {
+			t.Errorf("expected context '%s' but got '%s'", exp, event.Context)
+		}
+		ja := jsonassert.New(t)
+		ja.Assertf(asJSON(t, event.SeverityReason), `{"type": "log"}`)
+		if exp := "error"; event.Severity != exp {
+			t.Errorf("expected severity '%s' but got '%s'", exp, event.Severity)
+		}
+		ja.Assertf(asJSON(t, event.Metadata), `{
+			"log": { "requestID": "abc" },
+			"payment": { "provider": "stripe", "amount": 42, "card.brand": "visa" }
+		}`)
+		ja.Assertf(asJSON(t, event.Exceptions[0].Message), `"unable to charge card: card declined"`)
+		ja.Assertf(asJSON(t, event.Breadcrumbs), `[{
+			"name": "unable to charge card",
+			"type": "log",
+			"timestamp": "<<PRESENCE>>",
+			"metaData": { "level": "ERROR", "requestID": "abc", "payment.provider": "stripe", "payment.amount": 42, "payment.card.brand": "visa" }
+		}]`)
+	})
+
+	t.Run("reports logs with an error attribute below the notify level", func(t *testing.T) {
+		t.Parallel()
+		logger, _, _, reps := makeLogger(t)
+		logger.Warn("retrying", "err", errors.New("connection reset"))
+
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		if exp, sev := "warning", got[0].Events[0].Severity; sev != exp {
+			t.Errorf("expected severity '%s' but got '%s'", exp, sev)
+		}
+	})
+
+	t.Run("reports error logs without an error attribute", func(t *testing.T) {
+		t.Parallel()
+		logger, _, _, reps := makeLogger(t)
+		logger.Error("100% of disk used")
+
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		if exp, msg := "100% of disk used", got[0].Events[0].Exceptions[0].Message; msg != exp {
+			t.Errorf("expected message '%s' but got '%s'", exp, msg)
+		}
+	})
+
+	t.Run("respects levels", func(t *testing.T) {
+		t.Parallel()
+		logger, _, buf, reps := makeLogger(t,
+			bugsnagslog.WithBreadcrumbLevel(slog.LevelWarn),
+			bugsnagslog.WithNotifyLevel(slog.LevelWarn),
+		)
+		logger.Info("ignored", "err", errors.New("not reported"))
+		logger.Warn("reported")
+
+		if got := buf.String(); strings.Contains(got, "ignored") {
+			t.Errorf("expected the wrapped handler's level to be respected but got: %s", got)
+		}
+		got := reps.Get()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 report but got %d", len(got))
+		}
+		if exp, msg := "reported", got[0].Events[0].Exceptions[0].Message; msg != exp {
+			t.Errorf("expected message '%s' but got '%s'", exp, msg)
+		}
+	})
+}
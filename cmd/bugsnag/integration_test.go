@@ -4,6 +4,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -100,6 +102,9 @@ func TestRelease(t *testing.T) {
 		err := run(strings.Split(cmd, " "), map[string]string{
 			"BUGSNAG_API_KEY": "1234abcd1234abcd1234abcd1234abcd",
 			"APP_VERSION":     "2.5.2",
+			// Invalid values of variables not used by the command are ignored.
+			"BUGSNAG_SESSION_PUBLISH_INTERVAL": "60",
+			"BUGSNAG_MAX_BREADCRUMBS":          "abc",
 		})
 		if err != nil {
 			t.Fatal(err)
@@ -119,4 +124,33 @@ func TestRelease(t *testing.T) {
 			"releaseStage": "production"
 		}`)
 	})
+
+	t.Run("uses config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "bugsnag.env")
+		config := "# Overridden by the environment\nBUGSNAG_API_KEY=0000abcd1234abcd1234abcd1234abcd\nBUGSNAG_APP_VERSION=\"3.0.0\"\n"
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := `release --endpoint=` + ts.URL + ` --config=` + path
+		err := run(strings.Split(cmd, " "), map[string]string{
+			"BUGSNAG_API_KEY": "1234abcd1234abcd1234abcd1234abcd",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body string
+		select {
+		case body = <-reqs:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("no request received after half a second.")
+		}
+
+		jsonassert.New(t).Assertf(body, `
+		{
+			"apiKey": "1234abcd1234abcd1234abcd1234abcd",
+			"appVersion": "3.0.0",
+			"releaseStage": "production"
+		}`)
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/kinbiko/bugsnag"
 	"github.com/kinbiko/bugsnag/builds"
 )
 
@@ -23,6 +24,7 @@ type releaseFlags struct {
 	endpoint          *string
 	appVersionCode    *int
 	appBundleVersion  *string
+	config            *string
 	debug             *bool
 }
 
@@ -107,6 +109,13 @@ The SHA (or 7-character shorthand) of the git commit associated with the build.`
 			`Optional. Applies to Android builds only.`,
 		),
 
+		config: releaseCmd.String(
+			"config",
+			"",
+			`Optional. Path to a config file of BUGSNAG_* variables, one NAME=VALUE pair per line.
+Environment variables take precedence over the variables in this file.`,
+		),
+
 		debug: releaseCmd.Bool("debug", false, "Turn on for debug logs"),
 	}
 }
@@ -141,7 +150,19 @@ func (app *application) runRelease(envVars map[string]string) error {
 	}
 
 	req := makeRelease(flags)
-	populateReleaseDefaults(req, envVars)
+	if path := *flags.config; path != "" {
+		vars, err := bugsnag.ReadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		for name, value := range envVars {
+			vars[name] = value
+		}
+		envVars = vars
+	}
+	if err := populateReleaseDefaults(req, envVars); err != nil {
+		return err
+	}
 
 	if err := req.Validate(); err != nil {
 		return fmt.Errorf("invalid build data: %w\nSee 'bugsnag release --help'", err)
@@ -173,18 +194,28 @@ func (app *application) printReleaseDebug() {
 	logf("--endpoint=%s\n", *flags.endpoint)
 	logf("--app-version-code=%d\n", *flags.appVersionCode)
 	logf("--app-bundle-version=%s\n", *flags.appBundleVersion)
+	logf("--config=%s\n", *flags.config)
 	logf("--debug=%v\n", *flags.debug)
 }
 
-func populateReleaseDefaults(req *builds.JSONBuildRequest, envVars map[string]string) {
+// populateReleaseDefaults populates the fields not given as flags from the
+// same variables that bugsnag.ConfigurationFromEnv reads.
+// Only the variables used by this command are read, such that invalid values
+// of any other variables, which only matter to the notifier, are ignored.
+func populateReleaseDefaults(req *builds.JSONBuildRequest, envVars map[string]string) error {
+	cfg, err := bugsnag.ConfigurationFromVars(map[string]string{
+		"BUGSNAG_API_KEY":     envVars["BUGSNAG_API_KEY"],
+		"BUGSNAG_APP_VERSION": envVars["BUGSNAG_APP_VERSION"],
+		"APP_VERSION":         envVars["APP_VERSION"],
+	})
+	if err != nil {
+		return err
+	}
 	if req.APIKey == "" {
-		req.APIKey = envVars["BUGSNAG_API_KEY"]
+		req.APIKey = cfg.APIKey
 	}
-
 	if req.AppVersion == "" {
-		req.AppVersion = envVars["BUGSNAG_APP_VERSION"]
-		if req.AppVersion == "" {
-			req.AppVersion = envVars["APP_VERSION"]
-		}
+		req.AppVersion = cfg.AppVersion
 	}
+	return nil
 }
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"regexp"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -25,6 +28,7 @@ type Configuration struct {
 	// *have* to use a non-semver AppVersion, set this configuration option to
 	// any valid semver, and change the AppVersion as part of of your
 	// ErrorReportSanitizer.
+	// May be left empty if AutoAppVersion is set.
 	AppVersion string
 	// The stage in your release cycle, e.g. "development", "production", etc.
 	// Any non-empty value is valid.
@@ -36,6 +40,34 @@ type Configuration struct {
 
 	// Optional configuration options:
 
+	// AutoAppVersion derives the AppVersion, if not set, from the build info
+	// embedded in your binary: the version of the main module, if known, or
+	// else a pseudo-version made from the VCS revision and commit time, with a
+	// "+dirty" suffix if the working tree had uncommitted changes, e.g.
+	// "0.0.0-20240102150405-abcdef123456+dirty".
+	// The VCS revision, time and modified flag are also attached to error
+	// reports in the "app" tab of the metadata.
+	// Note that VCS information is only embedded when building a main package
+	// within a repository, and not for e.g. go run or go test.
+	AutoAppVersion bool
+
+	// EnabledReleaseStages, if not nil, lists the release stages in which
+	// errors are reported and sessions are tracked. In any other release
+	// stage Notify and StartSession don't report anything to Bugsnag, e.g. to
+	// avoid noise from developers running your app locally.
+	// Leave nil to report in all release stages.
+	EnabledReleaseStages []string
+	// SanitizeDisabledReleaseStages runs the ErrorReportSanitizer and
+	// SessionStartSanitizer even in release stages not listed in
+	// EnabledReleaseStages, e.g. in order to test your sanitizers locally.
+	// Nothing is reported to Bugsnag regardless.
+	SanitizeDisabledReleaseStages bool
+	// DryRunWriter, if set, receives the JSON payloads of error reports and
+	// session reports, indented for readability, instead of them being sent
+	// to Bugsnag. This is useful for inspecting the data reported by your
+	// app, e.g. by setting it to os.Stderr when running locally.
+	DryRunWriter io.Writer
+
 	// The endpoint to send error reports to. Configure if you're
 	// using an on-premise installation of Bugsnag. Defaults to
 	// https://notify.bugsnag.com
@@ -47,10 +79,125 @@ type Configuration struct {
 	// If this field is set you must also set EndpointNotify.
 	EndpointSessions string
 
+	// TrustedProxyHeaders lists the request headers, in order of precedence,
+	// that WithRequest reads the client IP from, e.g. "X-Forwarded-For" or
+	// "X-Real-Ip". Only list headers that are set by proxies you control, as
+	// clients may set any header they like. If none of the headers are
+	// present, the remote address of the request is used.
+	// As proxies append to headers such as X-Forwarded-For, and clients may
+	// send any value of their own, the rightmost entry that isn't a private or
+	// loopback address is used as the client IP, falling back to the
+	// rightmost entry if all entries are private.
+	TrustedProxyHeaders []string
+
+	// MaxBreadcrumbs is the maximum number of breadcrumbs kept per context
+	// (or breadcrumb recorder). Once reached, the oldest breadcrumbs are
+	// dropped, and the number of dropped breadcrumbs is included under the
+	// "dropped" key of the "breadcrumbs" tab of the metadata of error reports.
+	// Defaults to 100. Set to a negative number to disable the limit.
+	MaxBreadcrumbs int
+	// MaxBreadcrumbMetadataBytes is the maximum size of the JSON encoded
+	// metadata of a single breadcrumb. Metadata exceeding this size is
+	// replaced with a note about its removal.
+	// Defaults to 4096. Set to a negative number to disable the limit.
+	MaxBreadcrumbMetadataBytes int
+
+	// RedactedKeys lists the keys whose values are replaced with
+	// "[REDACTED]" in the metadata, including nested maps and structs, the
+	// metadata of breadcrumbs, the request headers, and the query parameters
+	// of the request URL of error reports, both before and after the
+	// ErrorReportSanitizer is invoked. Keys wrapped in slashes, e.g.
+	// "/^x-.*-key$/", are regular expressions, and any other keys match any
+	// key containing them, ignoring case. The keys of structs are their JSON
+	// field names. Values of types that can't hold a string, e.g. the values
+	// of a map[string]int, are replaced with their zero value instead.
+	// Defaults to "password", "authorization", "cookie" and "token". Set to
+	// an empty, non-nil slice to disable redaction.
+	RedactedKeys []string
+
+	// DiscardErrors lists errors that are never reported, e.g.
+	// context.Canceled or io.EOF. Errors are discarded if errors.Is reports
+	// that the reported error matches any of them.
+	DiscardErrors []error
+	// DiscardErrorTypes lists examples of error types that are never
+	// reported, e.g. (*net.OpError)(nil). Errors are discarded if errors.As
+	// finds an error of any of these types in the reported error.
+	DiscardErrorTypes []error
+	// DiscardErrorClasses lists the error classes, as shown in the Bugsnag
+	// dashboard, e.g. "*net.OpError", of errors that are never reported.
+	// Errors are discarded if any error in their chain of wrapped errors has
+	// any of these classes.
+	DiscardErrorClasses []string
+	// DiscardMessages lists regular expressions matching the messages of
+	// errors that are never reported. Errors are discarded if the message of
+	// any error in their chain of wrapped errors matches any of these.
+	DiscardMessages []string
+
+	// LegacySerializationFormat makes Serialize produce the unversioned format
+	// of earlier versions of this package, which is neither compressed nor
+	// signed. Enable this while rolling out this version of the package, such
+	// that services still running an earlier version can deserialize the
+	// data, and disable it once all consuming services have been upgraded.
+	// Deserialize accepts both formats regardless, unless
+	// PropagationSigningKeys are configured, so the two can't be combined.
+	LegacySerializationFormat bool
+	// CompressSerializedData enables the compression of the output of
+	// Serialize. Only enable this once all services that Deserialize this
+	// data run a version of this package that supports compression.
+	CompressSerializedData bool
+	// MaxSerializedBytes is the maximum size of the output of Serialize.
+	// The oldest breadcrumbs are dropped until the output fits within this
+	// limit, as proxies commonly reject requests with large headers.
+	// Defaults to 4096. Set to a negative number to disable the limit.
+	MaxSerializedBytes int
+
+	// PropagatedMetadataTabs, if not nil, restricts the metadata propagated
+	// between services with Serialize and Deserialize to the listed tabs, and
+	// prevents User data from being propagated at all.
+	// Leave nil to propagate all metadata and User data.
+	PropagatedMetadataTabs []string
+
+	// PropagationSigningKeys, if set, are the keys used to sign the output of
+	// Serialize, and to verify the input of Deserialize, preventing clients
+	// from injecting diagnostic data into your error reports. All services
+	// propagating diagnostic data between each other must share these keys.
+	// The output of Serialize is signed with the first key, and Deserialize
+	// accepts data signed with any of the keys, rejecting unsigned data. To
+	// rotate keys, first add the new key as the last key to all services,
+	// then move it to the front, and finally remove the old key.
+	// Can't be combined with LegacySerializationFormat, as the legacy format
+	// can't be signed.
+	PropagationSigningKeys [][]byte
+
+	// TraceExtractor, if defined, is used to correlate error reports with the
+	// trace and span active in the context the error was reported with. See
+	// the GoDoc on the TraceExtractor type for more details.
+	// Falls back to the trace attached with WithTraceParent.
+	TraceExtractor TraceExtractor
+
+	// SessionPublishInterval is how often sessions started with StartSession
+	// are published to Bugsnag. Defaults to one minute.
+	SessionPublishInterval time.Duration
+	// SessionPerProcess starts a single session when the notifier is created
+	// with New, and counts errors reported with a context that has no session
+	// attached against this session. This is useful for command line tools and
+	// batch jobs, where the process is the unit of work, as it provides a
+	// stability score without calling StartSession.
+	SessionPerProcess bool
+	// MaxSessionsPerPayload, if positive, publishes sessions early, as soon
+	// as this many sessions have been started since sessions were last
+	// published. Defaults to no limit.
+	MaxSessionsPerPayload int
+
 	// If defined it will be invoked just before each error report API call to
 	// Bugsnag. See the GoDoc on the ErrorReportSanitizer type for more details.
 	ErrorReportSanitizer ErrorReportSanitizer
 
+	// If defined it will be invoked for each session started with
+	// StartSession, before the session is counted. See the GoDoc on the
+	// SessionStartSanitizer type for more details.
+	SessionStartSanitizer SessionStartSanitizer
+
 	// If defined it will be invoked just before each session report API call
 	// to Bugsnag. See the GoDoc on the SessionReportSanitizer type for more details.
 	SessionReportSanitizer SessionReportSanitizer
@@ -61,6 +208,8 @@ type Configuration struct {
 	// reports or sessions.
 	InternalErrorCallback func(err error)
 
+	redactor redactor
+
 	runtimeConstants
 }
 
@@ -77,10 +226,28 @@ func (cfg *Configuration) populateDefaults() {
 		cfg.EndpointNotify = "https://notify.bugsnag.com"
 		cfg.EndpointSessions = "https://sessions.bugsnag.com"
 	}
+	if cfg.MaxBreadcrumbs == 0 {
+		cfg.MaxBreadcrumbs = 100
+	}
+	if cfg.MaxBreadcrumbMetadataBytes == 0 {
+		cfg.MaxBreadcrumbMetadataBytes = 4096
+	}
+	if cfg.MaxSerializedBytes == 0 {
+		cfg.MaxSerializedBytes = 4096
+	}
+	if cfg.RedactedKeys == nil {
+		cfg.RedactedKeys = defaultRedactedKeys
+	}
+	if cfg.SessionPublishInterval <= 0 {
+		cfg.SessionPublishInterval = time.Minute
+	}
 	// Default to NOOP callbacks.
 	if cfg.ErrorReportSanitizer == nil {
 		cfg.ErrorReportSanitizer = func(_ context.Context, _ *JSONErrorReport) error { return nil }
 	}
+	if cfg.SessionStartSanitizer == nil {
+		cfg.SessionStartSanitizer = func(_ context.Context, _ *SessionStart) error { return nil }
+	}
 	if cfg.SessionReportSanitizer == nil {
 		cfg.SessionReportSanitizer = func(_ *JSONSessionReport) error { return nil }
 	}
@@ -89,6 +256,12 @@ func (cfg *Configuration) populateDefaults() {
 	}
 }
 
+// releaseStageEnabled reports whether errors and sessions should be reported
+// in the configured release stage.
+func (cfg *Configuration) releaseStageEnabled() bool {
+	return cfg.EnabledReleaseStages == nil || slices.Contains(cfg.EnabledReleaseStages, cfg.ReleaseStage)
+}
+
 func (cfg *Configuration) validate() error {
 	if r := regexp.MustCompile("^[0-9a-f]{32}$"); !r.MatchString(cfg.APIKey) {
 		return fmt.Errorf(`API key must be 32 hex characters, but got "%s"`, cfg.APIKey)
@@ -107,6 +280,9 @@ func (cfg *Configuration) validate() error {
 	if r := regexp.MustCompile(semverRegex); !r.MatchString(cfg.AppVersion) {
 		return errors.New("app version must be valid semver")
 	}
+	if cfg.LegacySerializationFormat && len(cfg.PropagationSigningKeys) > 0 {
+		return errors.New("legacy serialization format can't be combined with propagation signing keys")
+	}
 	return nil
 }
 
@@ -118,6 +294,11 @@ type runtimeConstants struct {
 	notifierVersion string
 	appID           string
 
+	mainVersion string
+	vcsRevision string
+	vcsTime     string
+	vcsModified string
+
 	appStartTime time.Time
 }
 
@@ -132,6 +313,14 @@ func makeRuntimeConstants() runtimeConstants {
 		notifierVersion = "SNAPSHOT"
 	)
 
+	rc := runtimeConstants{
+		osVersion:    osVersion(),
+		goVersion:    runtime.Version(),
+		osName:       runtime.GOOS,
+		appStartTime: time.Now(),
+		hostname:     func() string { h, _ := os.Hostname(); return h }(),
+	}
+
 	if bi, ok := debug.ReadBuildInfo(); ok {
 		appID = bi.Path
 		for _, dep := range bi.Deps {
@@ -140,15 +329,60 @@ func makeRuntimeConstants() runtimeConstants {
 				break
 			}
 		}
+		rc.mainVersion = bi.Main.Version
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rc.vcsRevision = s.Value
+			case "vcs.time":
+				rc.vcsTime = s.Value
+			case "vcs.modified":
+				rc.vcsModified = s.Value
+			}
+		}
 	}
 
-	return runtimeConstants{
-		osVersion:       osVersion(),
-		goVersion:       runtime.Version(),
-		osName:          runtime.GOOS,
-		appStartTime:    time.Now(),
-		hostname:        func() string { h, _ := os.Hostname(); return h }(),
-		notifierVersion: notifierVersion,
-		appID:           appID,
+	rc.notifierVersion = notifierVersion
+	rc.appID = appID
+	return rc
+}
+
+// autoAppVersion derives an app version from the build info, returning an
+// empty string if the build info has no version or VCS information.
+func (rc *runtimeConstants) autoAppVersion() string {
+	if v := rc.mainVersion; v != "" && v != "(devel)" {
+		return strings.TrimPrefix(v, "v")
+	}
+	if rc.vcsRevision == "" {
+		return ""
+	}
+	const revisionLength = 12 // as in Go module pseudo-versions
+	revision := rc.vcsRevision
+	if len(revision) > revisionLength {
+		revision = revision[:revisionLength]
+	}
+	version := "0.0.0-" + revision
+	if t, err := time.Parse(time.RFC3339, rc.vcsTime); err == nil {
+		version = "0.0.0-" + t.UTC().Format("20060102150405") + "-" + revision
+	}
+	if rc.vcsModified == "true" {
+		version += "+dirty"
+	}
+	return version
+}
+
+// vcsMetadata returns the VCS information of the build info, as attached to
+// the "app" metadata tab when AutoAppVersion is set.
+func (rc *runtimeConstants) vcsMetadata() map[string]interface{} {
+	if rc.vcsRevision == "" {
+		return nil
+	}
+	md := map[string]interface{}{"vcsRevision": rc.vcsRevision}
+	if rc.vcsTime != "" {
+		md["vcsTime"] = rc.vcsTime
+	}
+	if rc.vcsModified != "" {
+		md["vcsModified"] = rc.vcsModified == "true"
 	}
+	return md
 }
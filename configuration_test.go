@@ -1,6 +1,11 @@
 package bugsnag
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
 
 func TestConfigurationValidation(t *testing.T) {
 	for _, tc := range []struct {
@@ -94,6 +99,19 @@ func TestConfigurationValidation(t *testing.T) {
 			},
 			expMsg: `app version must be valid semver`,
 		},
+		{
+			name: "legacy serialization format with signing keys",
+			cfg: Configuration{
+				APIKey:                    "b1234590abcabcabcabcddddddddabcd",
+				EndpointNotify:            "https://notify.bugsnag.com",
+				EndpointSessions:          "http://localhost:8080",
+				ReleaseStage:              "dev",
+				AppVersion:                "1.2.3",
+				LegacySerializationFormat: true,
+				PropagationSigningKeys:    [][]byte{[]byte("key")},
+			},
+			expMsg: `legacy serialization format can't be combined with propagation signing keys`,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := tc.cfg.validate()
@@ -109,3 +127,70 @@ func TestConfigurationValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestAutoAppVersion(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name string
+		rc   runtimeConstants
+		exp  string
+	}{
+		{name: "no build info", exp: ""},
+		{name: "devel module version only", rc: runtimeConstants{mainVersion: "(devel)"}, exp: ""},
+		{name: "module version", rc: runtimeConstants{mainVersion: "v1.4.2", vcsRevision: "abcdef1234567890"}, exp: "1.4.2"},
+		{
+			name: "clean VCS build",
+			rc:   runtimeConstants{mainVersion: "(devel)", vcsRevision: "abcdef1234567890", vcsTime: "2024-01-02T15:04:05Z", vcsModified: "false"},
+			exp:  "0.0.0-20240102150405-abcdef123456",
+		},
+		{
+			name: "dirty VCS build",
+			rc:   runtimeConstants{vcsRevision: "abcdef1234567890", vcsTime: "2024-01-02T15:04:05Z", vcsModified: "true"},
+			exp:  "0.0.0-20240102150405-abcdef123456+dirty",
+		},
+		{name: "VCS build without time", rc: runtimeConstants{vcsRevision: "abc123"}, exp: "0.0.0-abc123"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := tc.rc.autoAppVersion()
+			if got != tc.exp {
+				t.Errorf("expected '%s' but got '%s'", tc.exp, got)
+			}
+			if got != "" && (&Configuration{
+				APIKey:           "abcd1234abcd1234abcd1234abcd1234",
+				EndpointNotify:   "https://notify.bugsnag.com",
+				EndpointSessions: "https://sessions.bugsnag.com",
+				ReleaseStage:     "dev",
+				AppVersion:       got,
+			}).validate() != nil {
+				t.Errorf("expected '%s' to be a valid app version", got)
+			}
+		})
+	}
+
+	t.Run("New fails without build info", func(t *testing.T) {
+		t.Parallel()
+		// Test binaries don't embed VCS information.
+		_, err := New(Configuration{APIKey: "abcd1234abcd1234abcd1234abcd1234", ReleaseStage: "dev", AutoAppVersion: true})
+		if err == nil {
+			t.Error("expected an error as the app version can't be determined but got none")
+		}
+	})
+
+	t.Run("VCS metadata", func(t *testing.T) {
+		t.Parallel()
+		n, err := New(Configuration{APIKey: "abcd1234abcd1234abcd1234abcd1234", ReleaseStage: "dev", AppVersion: "1.2.3", AutoAppVersion: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.cfg.runtimeConstants = runtimeConstants{vcsRevision: "abcdef1234567890", vcsTime: "2024-01-02T15:04:05Z", vcsModified: "true"}
+		ctx := n.WithMetadatum(context.Background(), "app", "vcsRevision", "overridden")
+		ctx = n.WithMetadatum(ctx, "app", "shard", 3)
+
+		report, _ := n.makeReport(ctx, errors.New("oops"))
+		exp := map[string]interface{}{"vcsRevision": "overridden", "vcsTime": "2024-01-02T15:04:05Z", "vcsModified": true, "shard": 3}
+		if got := report.Events[0].Metadata["app"]; !reflect.DeepEqual(got, exp) {
+			t.Errorf("expected app metadata %v but got %v", exp, got)
+		}
+	})
+}
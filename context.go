@@ -2,9 +2,9 @@ package bugsnag
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -13,43 +13,9 @@ type ctxKey int
 const (
 	sessionKey ctxKey = iota + 1
 	ctxDataKey
+	breadcrumbRecorderKey
 )
 
-// Serialize extracts all the diagnostic data tracked within the given ctx to a
-// []byte that can later be deserialized using Deserialize. Useful for passing
-// diagnostic to downstream services in header values.
-func (n *Notifier) Serialize(ctx context.Context) []byte {
-	b, err := json.Marshal(getAttachedContextData(ctx))
-	if err != nil {
-		n.cfg.InternalErrorCallback(err)
-		return nil
-	}
-	return []byte(base64.StdEncoding.EncodeToString(b))
-}
-
-// Deserialize extracts diagnostic data that has previously been serialized
-// with Serialize and attaches it to the given ctx. Intended to be called in
-// server middleware to attach diagnostic data identified from upstream
-// services. As a result, any existing diagnostic data (session data from
-// StartSession not inclusive) will be wiped.
-// Note: If the upstream service attaches sensitive data this service should
-// not report (e.g. user info), then this too will be propagated in this
-// context, and you will have to use the ErrorReportSanitizer to remove this
-// data.
-func (n *Notifier) Deserialize(ctx context.Context, data []byte) context.Context {
-	jsonData, err := base64.StdEncoding.DecodeString(string(data))
-	if err != nil {
-		n.cfg.InternalErrorCallback(err)
-		return ctx
-	}
-	cd := &ctxData{}
-	if err := json.Unmarshal(jsonData, cd); err != nil {
-		n.cfg.InternalErrorCallback(err)
-		return ctx
-	}
-	return context.WithValue(ctx, ctxDataKey, cd)
-}
-
 type bcType int
 
 const (
@@ -97,10 +63,30 @@ func (b bcType) val() string {
 }
 
 type ctxData struct {
-	BContext    string                            `json:"cx"`
-	Breadcrumbs []Breadcrumb                      `json:"bc"`
-	User        *User                             `json:"us"`
-	Metadata    map[string]map[string]interface{} `json:"md"`
+	BContext    string                            `json:"cx,omitempty"`
+	Breadcrumbs []Breadcrumb                      `json:"bc,omitempty"`
+	User        *User                             `json:"us,omitempty"`
+	Metadata    map[string]map[string]interface{} `json:"md,omitempty"`
+
+	// FeatureFlags maps the names of feature flags to their variants.
+	FeatureFlags map[string]string `json:"ff,omitempty"`
+
+	// DroppedBreadcrumbs counts the breadcrumbs dropped from Breadcrumbs due
+	// to Configuration.MaxBreadcrumbs.
+	DroppedBreadcrumbs int `json:"db,omitempty"`
+
+	// Session identifies the session of the service that serialized the
+	// data. It's only set on serialized context data, as sessions are
+	// otherwise attached to contexts separately from the context data.
+	Session *propagatedSession `json:"se,omitempty"`
+
+	// Request describes the incoming request being served by this service,
+	// and is therefore deliberately excluded from serialization.
+	Request *JSONRequest `json:"-"`
+
+	// trace identifies the trace of this service that the context belongs
+	// to, and is therefore deliberately excluded from serialization.
+	trace *traceContext
 }
 
 // Breadcrumb represents user- and system-initiated events which led up
@@ -116,7 +102,7 @@ type Breadcrumb struct {
 
 	// Metadata contains any additional information about the breadcrumb, as
 	// key/value pairs.
-	Metadata map[string]interface{} `json:"md"`
+	Metadata map[string]interface{} `json:"md,omitempty"`
 
 	// Timestamp is set automatically to the current timestamp if not set.
 	Timestamp time.Time `json:"ts"`
@@ -124,26 +110,55 @@ type Breadcrumb struct {
 
 // WithBreadcrumb attaches a breadcrumb to the top of the stack of breadcrumbs
 // stored in the given context.
+// Once the stack holds Configuration.MaxBreadcrumbs breadcrumbs, the oldest
+// breadcrumb is dropped for each new breadcrumb. The metadata of breadcrumbs
+// that exceed Configuration.MaxBreadcrumbMetadataBytes is replaced with a
+// note about its removal.
+// If the context has a breadcrumb recorder attached (see
+// WithBreadcrumbRecorder), the breadcrumb is added to the recorder instead,
+// and the given context is returned as-is.
 func (n *Notifier) WithBreadcrumb(ctx context.Context, breadcrumb Breadcrumb) context.Context {
 	if ctx == nil {
 		return nil
 	}
-	// This function currently uses no features of the Notifier type, however
-	// we're attaching it to the Notifier to ensure that we can use
-	// Notifier-only functionalities in the future AND so that users need only
-	// import the bugsnag package in a single location in their app.
 	if breadcrumb.Timestamp.IsZero() {
 		breadcrumb.Timestamp = time.Now().UTC()
 	}
-	cd := getAttachedContextData(ctx)
-	cd.Breadcrumbs = append(cd.Breadcrumbs, breadcrumb)
-	return context.WithValue(ctx, ctxDataKey, cd)
+	breadcrumb.Metadata = n.capBreadcrumbMetadata(breadcrumb.Metadata)
+	if r := getBreadcrumbRecorder(ctx); r != nil {
+		r.record(breadcrumb)
+		return ctx
+	}
+	return withContextData(ctx, func(cd *ctxData) {
+		// Limit the capacity of the breadcrumbs to force append to copy them,
+		// as the underlying array is shared with the parent context.
+		cd.Breadcrumbs = append(cd.Breadcrumbs[:len(cd.Breadcrumbs):len(cd.Breadcrumbs)], breadcrumb)
+		if limit := n.cfg.MaxBreadcrumbs; limit > 0 && len(cd.Breadcrumbs) > limit {
+			dropped := len(cd.Breadcrumbs) - limit
+			cd.Breadcrumbs = cd.Breadcrumbs[dropped:]
+			cd.DroppedBreadcrumbs += dropped
+		}
+	})
+}
+
+func (n *Notifier) capBreadcrumbMetadata(md map[string]interface{}) map[string]interface{} {
+	limit := n.cfg.MaxBreadcrumbMetadataBytes
+	if limit <= 0 || md == nil {
+		return md
+	}
+	b, err := json.Marshal(md)
+	if err == nil && len(b) <= limit {
+		return md
+	}
+	return map[string]interface{}{
+		"removed": fmt.Sprintf("metadata removed as its size exceeded the limit of %d bytes", limit),
+	}
 }
 
-func makeBreadcrumbs(ctx context.Context) []*JSONBreadcrumb {
-	bcs := getAttachedContextData(ctx).Breadcrumbs
+func makeBreadcrumbs(ctx context.Context) ([]*JSONBreadcrumb, int) {
+	bcs, dropped := getBreadcrumbs(ctx)
 	if bcs == nil {
-		return nil
+		return nil, dropped
 	}
 
 	payloads := make([]*JSONBreadcrumb, len(bcs))
@@ -155,7 +170,7 @@ func makeBreadcrumbs(ctx context.Context) []*JSONBreadcrumb {
 			Metadata:  bc.Metadata,
 		}
 	}
-	return payloads
+	return payloads, dropped
 }
 
 // User information about the user affected by the error. These fields are
@@ -185,9 +200,7 @@ func (n *Notifier) WithUser(ctx context.Context, user User) context.Context {
 	// we're attaching it to the Notifier to ensure that we can use
 	// Notifier-only functionalities in the future AND so that users need only
 	// import the bugsnag package in a single location in their app.
-	cd := getAttachedContextData(ctx)
-	cd.User = &user
-	return context.WithValue(ctx, ctxDataKey, cd)
+	return withContextData(ctx, func(cd *ctxData) { cd.User = &user })
 }
 
 // WithBugsnagContext applies the given bContext as the "Context" for the errors that
@@ -201,9 +214,7 @@ func (n *Notifier) WithBugsnagContext(ctx context.Context, bContext string) cont
 	// we're attaching it to the Notifier to ensure that we can use
 	// Notifier-only functionalities in the future AND so that users need only
 	// import the bugsnag package in a single location in their app.
-	cd := getAttachedContextData(ctx)
-	cd.BContext = bContext
-	return context.WithValue(ctx, ctxDataKey, cd)
+	return withContextData(ctx, func(cd *ctxData) { cd.BContext = bContext })
 }
 
 // WithMetadatum attaches the given key and value under the provided tab in the
@@ -215,9 +226,13 @@ func (n *Notifier) WithMetadatum(ctx context.Context, tab, key string, value int
 	if ctx == nil {
 		return nil
 	}
-	m := initializeMetadataTab(ctx, tab)
-	m[tab][key] = value
-	return n.WithMetadata(ctx, tab, m[tab])
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	return withContextData(ctx, func(cd *ctxData) {
+		cd.Metadata = withMetadatum(cd.Metadata, tab, key, value)
+	})
 }
 
 // WithMetadata attaches the given data under the provided tab in the
@@ -233,15 +248,18 @@ func (n *Notifier) WithMetadata(ctx context.Context, tab string, data map[string
 	// we're attaching it to the Notifier to ensure that we can use
 	// Notifier-only functionalities in the future AND so that users need only
 	// import the bugsnag package in a single location in their app.
-	m := initializeMetadataTab(ctx, tab)
-	m[tab] = data
-	cd := getAttachedContextData(ctx)
-	cd.Metadata = m
-	return context.WithValue(ctx, ctxDataKey, cd)
+	kvs := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		kvs[k] = v
+	}
+	return withContextData(ctx, func(cd *ctxData) {
+		cd.Metadata = withMetadataTab(cd.Metadata, tab, kvs)
+	})
 }
 
 // Metadata pulls out all the metadata known by this package as a
 // map[tab]map[key]value from the given context.
+// The returned map is shared with the context, and must not be modified.
 func (n *Notifier) Metadata(ctx context.Context) map[string]map[string]interface{} {
 	// This function currently uses no features of the Notifier type, however
 	// we're attaching it to the Notifier to ensure that we can use
@@ -250,41 +268,59 @@ func (n *Notifier) Metadata(ctx context.Context) map[string]map[string]interface
 	return getAttachedContextData(ctx).Metadata
 }
 
-func initializeMetadataTab(ctx context.Context, tab string) map[string]map[string]interface{} {
-	metadata := getAttachedContextData(ctx).Metadata
-	if metadata == nil {
-		metadata = map[string]map[string]interface{}{}
+// withMetadatum returns a copy of the given metadata with the given key of
+// the given tab set, keeping the other keys of the tab.
+func withMetadatum(metadata map[string]map[string]interface{}, tab, key string, value interface{}) map[string]map[string]interface{} {
+	kvs := make(map[string]interface{}, len(metadata[tab])+1)
+	for k, v := range metadata[tab] {
+		kvs[k] = v
 	}
+	kvs[key] = value
+	return withMetadataTab(metadata, tab, kvs)
+}
 
-	if metadata[tab] == nil {
-		metadata[tab] = map[string]interface{}{}
+// withMetadataTab returns a copy of the given metadata with the given tab
+// replaced. The other tabs are shared with the given metadata.
+func withMetadataTab(metadata map[string]map[string]interface{}, tab string, kvs map[string]interface{}) map[string]map[string]interface{} {
+	md := make(map[string]map[string]interface{}, len(metadata)+1)
+	for t, v := range metadata {
+		md[t] = v
 	}
-	return metadata
+	md[tab] = kvs
+	return md
 }
 
 type jsonCtxData struct {
-	bContext    string
-	breadcrumbs []*JSONBreadcrumb
-	user        *JSONUser
-	session     *JSONSession
-	metadata    map[string]map[string]interface{}
+	bContext           string
+	breadcrumbs        []*JSONBreadcrumb
+	droppedBreadcrumbs int
+	user               *JSONUser
+	sess               *session
+	session            *JSONSession
+	request            *JSONRequest
+	metadata           map[string]map[string]interface{}
+	featureFlags       map[string]string
 }
 
-func extractAugmentedContextData(ctx context.Context, err error, unhandled bool) (*jsonCtxData, context.Context) {
+func extractAugmentedContextData(ctx context.Context, err error) (*jsonCtxData, context.Context) {
+	breadcrumbs, droppedBreadcrumbs := makeBreadcrumbs(ctx)
 	data := &jsonCtxData{
-		bContext:    getAttachedContextData(ctx).BContext,
-		breadcrumbs: makeBreadcrumbs(ctx),
-		user:        getAttachedContextData(ctx).User,
-		session:     makeJSONSession(ctx, unhandled),
-		metadata:    getAttachedContextData(ctx).Metadata,
+		bContext:           getAttachedContextData(ctx).BContext,
+		breadcrumbs:        breadcrumbs,
+		droppedBreadcrumbs: droppedBreadcrumbs,
+		user:               getAttachedContextData(ctx).User,
+		sess:               getSession(ctx),
+		request:            getAttachedContextData(ctx).Request,
 	}
+	data.mergeMetadata(getAttachedContextData(ctx).Metadata)
+	data.mergeFeatureFlags(getAttachedContextData(ctx).FeatureFlags)
 	lowestCtx := ctx
 	lowestErr := err
 	for {
 		if berr, ok := lowestErr.(*Error); ok {
 			ctx = berr.ctx
 			if ctx != nil {
-				data.updateFromCtx(ctx, unhandled)
+				data.updateFromCtx(ctx)
 				lowestCtx = ctx
 			}
 		}
@@ -300,28 +336,53 @@ func extractAugmentedContextData(ctx context.Context, err error, unhandled bool)
 	return data, lowestCtx
 }
 
-func (data *jsonCtxData) updateFromCtx(ctx context.Context, unhandled bool) {
+func (data *jsonCtxData) updateFromCtx(ctx context.Context) {
 	if dataBContext := getAttachedContextData(ctx).BContext; dataBContext != "" {
 		data.bContext = dataBContext
 	}
-	if dataBreadcrumbs := makeBreadcrumbs(ctx); dataBreadcrumbs != nil {
+	if dataBreadcrumbs, dropped := makeBreadcrumbs(ctx); dataBreadcrumbs != nil {
 		data.breadcrumbs = dataBreadcrumbs
+		data.droppedBreadcrumbs = dropped
 	}
 	if dataUser := getAttachedContextData(ctx).User; dataUser != nil {
 		data.user = dataUser
 	}
-	if dataSession := makeJSONSession(ctx, unhandled); dataSession != nil {
-		data.session = dataSession
+	if dataSession := getSession(ctx); dataSession != nil {
+		data.sess = dataSession
+	}
+	if dataRequest := getAttachedContextData(ctx).Request; dataRequest != nil {
+		data.request = dataRequest
 	}
 
-	dataMetadata := getAttachedContextData(ctx).Metadata
-	if dataMetadata == nil {
+	data.mergeMetadata(getAttachedContextData(ctx).Metadata)
+	data.mergeFeatureFlags(getAttachedContextData(ctx).FeatureFlags)
+}
+
+// mergeFeatureFlags copies the given flags into the flags of the report,
+// overwriting the variants of flags already present.
+func (data *jsonCtxData) mergeFeatureFlags(flags map[string]string) {
+	if flags == nil {
+		return
+	}
+	if data.featureFlags == nil {
+		data.featureFlags = map[string]string{}
+	}
+	for name, variant := range flags {
+		data.featureFlags[name] = variant
+	}
+}
+
+// mergeMetadata copies the given metadata into the metadata of the report,
+// such that the metadata of the report can be modified without affecting the
+// context the given metadata was attached to.
+func (data *jsonCtxData) mergeMetadata(metadata map[string]map[string]interface{}) {
+	if metadata == nil {
 		return
 	}
 	if data.metadata == nil {
 		data.metadata = map[string]map[string]interface{}{}
 	}
-	for tab, kvps := range dataMetadata {
+	for tab, kvps := range metadata {
 		if data.metadata[tab] == nil {
 			data.metadata[tab] = map[string]interface{}{}
 		}
@@ -331,6 +392,19 @@ func (data *jsonCtxData) updateFromCtx(ctx context.Context, unhandled bool) {
 	}
 }
 
+// withContextData returns a context holding a copy of the context data of the
+// given ctx, modified by update. The context data attached to a context is
+// never modified after the fact, so the copy shares its breadcrumbs and
+// metadata with the original: update must replace these rather than modify
+// them in place.
+func withContextData(ctx context.Context, update func(cd *ctxData)) context.Context {
+	cd := *getAttachedContextData(ctx)
+	update(&cd)
+	return context.WithValue(ctx, ctxDataKey, &cd)
+}
+
+// getAttachedContextData returns the context data attached to the given ctx,
+// which must not be modified.
 func getAttachedContextData(ctx context.Context) *ctxData {
 	if val := ctx.Value(ctxDataKey); val != nil {
 		return val.(*ctxData) //nolint:forcetypeassert // This is safe. We own the key => we own the type
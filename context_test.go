@@ -3,6 +3,8 @@ package bugsnag
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,7 +33,7 @@ func TestContextWithMethods(t *testing.T) {
 		ctx := n.WithBreadcrumb(context.Background(), expLatest)
 		ctx = n.WithBreadcrumb(ctx, expNewest)
 
-		bcs := makeBreadcrumbs(ctx)
+		bcs, _ := makeBreadcrumbs(ctx)
 
 		if len(bcs) != 2 {
 			t.Fatalf("expected 2 breadcrumbs but got %d", len(bcs))
@@ -42,6 +44,42 @@ func TestContextWithMethods(t *testing.T) {
 		ja.Assertf(asJSON(bcs[1]), `{ "timestamp": "<<PRESENCE>>", "name": "latest", "type": "manual" }`)
 	})
 
+	t.Run("WithBreadcrumb limits", func(t *testing.T) {
+		t.Parallel()
+		n, err := New(Configuration{
+			APIKey:                     "1234abcd1234abcd1234abcd1234abcd",
+			AppVersion:                 "1.2.3",
+			ReleaseStage:               "test",
+			MaxBreadcrumbs:             2,
+			MaxBreadcrumbMetadataBytes: 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		for _, name := range []string{"first", "second", "third", "fourth"} {
+			ctx = n.WithBreadcrumb(ctx, Breadcrumb{Name: name, Metadata: map[string]interface{}{"size": name}})
+		}
+
+		bcs, dropped := makeBreadcrumbs(ctx)
+		if dropped != 2 {
+			t.Errorf("expected 2 dropped breadcrumbs but got %d", dropped)
+		}
+		if len(bcs) != 2 || bcs[0].Name != "fourth" || bcs[1].Name != "third" {
+			t.Fatalf("expected the two newest breadcrumbs but got %+v", bcs)
+		}
+		if got := bcs[0].Metadata["size"]; got != "fourth" {
+			t.Errorf("expected small metadata to be kept but got %v", got)
+		}
+
+		ctx = n.WithBreadcrumb(ctx, Breadcrumb{Name: "big", Metadata: map[string]interface{}{"size": "way too big"}})
+		bcs, _ = makeBreadcrumbs(ctx)
+		if _, ok := bcs[0].Metadata["size"]; ok || bcs[0].Metadata["removed"] == nil {
+			t.Errorf("expected large metadata to be removed but got %v", bcs[0].Metadata)
+		}
+	})
+
 	t.Run("WithUser", func(t *testing.T) {
 		t.Parallel()
 		exp := User{ID: "id", Name: "name", Email: "email"}
@@ -75,6 +113,9 @@ func TestContextWithMethods(t *testing.T) {
 			{"WithMetadata", func() { n.WithMetadata(ctx, "whatever", map[string]interface{}{}) }},
 			{"WithMetadatum", func() { n.WithMetadatum(ctx, "whatever", "foo", "bar") }},
 			{"WithUser", func() { n.WithUser(ctx, User{}) }},
+			{"WithRequest", func() { n.WithRequest(ctx, nil) }},
+			{"WithFeatureFlag", func() { n.WithFeatureFlag(ctx, "flag", "variant") }},
+			{"ClearFeatureFlag", func() { n.ClearFeatureFlag(ctx, "flag") }},
 		} {
 			t.Run(tc.name, func(t *testing.T) {
 				t.Parallel()
@@ -141,7 +182,7 @@ func TestUpdateFromCtx(t *testing.T) {
 	ctx = n.WithMetadatum(ctx, "app", "types", []string{"fire"})
 
 	got := jsonCtxData{}
-	got.updateFromCtx(ctx, false)
+	got.updateFromCtx(ctx)
 	b, _ := json.Marshal(getAttachedContextData(ctx))
 	jsonassert.New(t).Assertf(string(b), `{
 		"cx": "/pokemon?type=fire",
@@ -150,3 +191,104 @@ func TestUpdateFromCtx(t *testing.T) {
 		"md":{"app": {"nick": "charmander", "types": ["fire"]}}
 	}`)
 }
+
+func TestContextDataIsImmutable(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("siblings don't leak into each other", func(t *testing.T) {
+		t.Parallel()
+		parent := n.WithBreadcrumb(context.Background(), Breadcrumb{Name: "parent"})
+		parent = n.WithMetadatum(parent, "tab", "parent", true)
+		parent = n.WithBugsnagContext(parent, "parent")
+		// Add a second breadcrumb so that append has spare capacity to
+		// (incorrectly) reuse.
+		parent = n.WithBreadcrumb(parent, Breadcrumb{Name: "parent 2"})
+
+		a := n.WithBreadcrumb(parent, Breadcrumb{Name: "a"})
+		a = n.WithMetadatum(a, "tab", "a", true)
+		a = n.WithUser(a, User{ID: "a"})
+		b := n.WithBreadcrumb(parent, Breadcrumb{Name: "b"})
+		b = n.WithMetadata(b, "tab", map[string]interface{}{"b": true})
+		b = n.WithBugsnagContext(b, "b")
+
+		pcd, acd, bcd := getAttachedContextData(parent), getAttachedContextData(a), getAttachedContextData(b)
+		if len(pcd.Breadcrumbs) != 2 || pcd.User != nil || pcd.BContext != "parent" {
+			t.Errorf("expected parent context data to be unchanged but got %+v", pcd)
+		}
+		if got := pcd.Metadata["tab"]; len(got) != 1 || got["parent"] != true {
+			t.Errorf("expected parent metadata to be unchanged but got %v", got)
+		}
+		if got := acd.Breadcrumbs[2].Name; got != "a" {
+			t.Errorf("expected the newest breadcrumb of a to be 'a' but was '%s'", got)
+		}
+		if got := acd.Metadata["tab"]; len(got) != 2 || got["parent"] != true || got["a"] != true {
+			t.Errorf("expected metadata of a to contain 'parent' and 'a' but got %v", got)
+		}
+		if got := bcd.Breadcrumbs[2].Name; got != "b" {
+			t.Errorf("expected the newest breadcrumb of b to be 'b' but was '%s'", got)
+		}
+		if got := bcd.Metadata["tab"]; len(got) != 1 || got["b"] != true {
+			t.Errorf("expected metadata of b to only contain 'b' but got %v", got)
+		}
+		if bcd.User != nil || acd.BContext != "parent" {
+			t.Errorf("expected siblings to not leak into each other but got %+v and %+v", acd, bcd)
+		}
+	})
+
+	t.Run("WithMetadata copies the given data", func(t *testing.T) {
+		t.Parallel()
+		data := map[string]interface{}{"key": "before"}
+		ctx := n.WithMetadata(context.Background(), "tab", data)
+		data["key"] = "after"
+		n.WithMetadatum(ctx, "tab", "other", "value")
+		if got := n.Metadata(ctx)["tab"]; len(got) != 1 || got["key"] != "before" {
+			t.Errorf("expected the attached metadata to be unchanged but got %v", got)
+		}
+	})
+
+	t.Run("reporting doesn't modify the context", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithMetadatum(context.Background(), "tab", "outer", 1)
+		inner := n.WithMetadatum(ctx, "tab", "inner", 2)
+		n.makeReport(ctx, Wrap(inner, errors.New("oops")))
+		if got := n.Metadata(ctx)["tab"]; len(got) != 1 {
+			t.Errorf("expected the metadata of the context to be unchanged but got %v", got)
+		}
+	})
+
+	t.Run("concurrent fan-out from a shared parent", func(t *testing.T) {
+		t.Parallel()
+		parent := n.WithBreadcrumb(context.Background(), Breadcrumb{Name: "parent"})
+		parent = n.WithMetadatum(parent, "tab", "parent", true)
+		const goroutines = 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx := n.WithBreadcrumb(parent, Breadcrumb{Name: "child"})
+				ctx = n.WithMetadatum(ctx, "tab", "child", i)
+				ctx = n.WithUser(ctx, User{ID: "child"})
+				ctx = n.WithBugsnagContext(ctx, "child")
+				n.Serialize(ctx)
+				n.makeReport(ctx, Wrap(ctx, errors.New("oops")))
+				if got := n.Metadata(ctx)["tab"]["child"]; got != i {
+					t.Errorf("expected metadatum 'child' to be %d but was %v", i, got)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if bcs := getAttachedContextData(parent).Breadcrumbs; len(bcs) != 1 {
+			t.Errorf("expected the parent to have 1 breadcrumb but got %d", len(bcs))
+		}
+		if got := n.Metadata(parent)["tab"]; len(got) != 1 {
+			t.Errorf("expected the parent metadata to be unchanged but got %v", got)
+		}
+	})
+}
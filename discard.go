@@ -0,0 +1,95 @@
+package bugsnag
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+)
+
+// discardRule discards the errors it matches, counting the errors it has
+// discarded.
+type discardRule struct {
+	name    string
+	matches func(err error) bool
+	count   atomic.Uint64
+}
+
+// makeDiscardRules makes the discard rules of the given configuration,
+// returning an error if any of the rules are invalid.
+func makeDiscardRules(cfg *Configuration) ([]*discardRule, error) {
+	var rules []*discardRule
+	for _, target := range cfg.DiscardErrors {
+		rules = append(rules, &discardRule{
+			name:    fmt.Sprintf("error %q", target),
+			matches: func(err error) bool { return errors.Is(err, target) },
+		})
+	}
+	for _, example := range cfg.DiscardErrorTypes {
+		if example == nil {
+			return nil, errors.New("discarded error types must not be nil interfaces")
+		}
+		typ := reflect.TypeOf(example)
+		rules = append(rules, &discardRule{
+			name:    "type " + typ.String(),
+			matches: func(err error) bool { return errors.As(err, reflect.New(typ).Interface()) },
+		})
+	}
+	for _, class := range cfg.DiscardErrorClasses {
+		rules = append(rules, &discardRule{
+			name: "class " + class,
+			matches: func(err error) bool {
+				for _, e := range errorChain(err) {
+					if reflect.TypeOf(e).String() == class {
+						return true
+					}
+				}
+				return false
+			},
+		})
+	}
+	for _, expr := range cfg.DiscardMessages {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid discarded message regex %q: %w", expr, err)
+		}
+		rules = append(rules, &discardRule{
+			name: "message /" + expr + "/",
+			matches: func(err error) bool {
+				for _, e := range errorChain(err) {
+					if re.MatchString(e.Error()) {
+						return true
+					}
+				}
+				return false
+			},
+		})
+	}
+	return rules, nil
+}
+
+// discard reports whether the given error matches any of the discard rules,
+// counting the error against the first rule it matches.
+func (n *Notifier) discard(err error) bool {
+	for _, rule := range n.discardRules {
+		if rule.matches(err) {
+			rule.count.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// DiscardCounts returns the number of errors discarded by each of the
+// discard rules in the Configuration since the notifier was created, keyed by
+// a description of the rule, e.g. `error "context canceled"`,
+// "type *net.OpError", "class *url.Error" or "message /^EOF$/".
+// Rules that haven't discarded any errors are included with a count of zero.
+func (n *Notifier) DiscardCounts() map[string]int {
+	counts := make(map[string]int, len(n.discardRules))
+	for _, rule := range n.discardRules {
+		counts[rule.name] += int(rule.count.Load())
+	}
+	return counts
+}
@@ -0,0 +1,85 @@
+package bugsnag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDiscardRules(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		reported []string
+	)
+	errDomain := errors.New("order already shipped")
+	n, err := New(Configuration{
+		APIKey:              "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage:        "dev",
+		AppVersion:          "1.2.3",
+		DiscardErrors:       []error{context.Canceled, io.EOF, errDomain},
+		DiscardErrorTypes:   []error{(*fs.PathError)(nil)},
+		DiscardErrorClasses: []string{"*bugsnag.discardTestError"},
+		DiscardMessages:     []string{"^connection reset"},
+		ErrorReportSanitizer: func(_ context.Context, r *JSONErrorReport) error {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, r.Events[0].Exceptions[0].Message)
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+
+	ctx := context.Background()
+	for _, err := range []error{
+		context.Canceled,
+		n.Wrap(ctx, fmt.Errorf("reading body: %w", io.EOF), "client disconnected"),
+		fmt.Errorf("unable to cancel: %w", errDomain),
+		&fs.PathError{Op: "open", Path: "/tmp/x", Err: fs.ErrNotExist},
+		fmt.Errorf("handling request: %w", &discardTestError{}),
+		fmt.Errorf("upstream: %w", errors.New("connection reset by peer")),
+		errors.New("not discarded"),
+	} {
+		n.Notify(ctx, err)
+	}
+
+	if exp := []string{"not discarded"}; !reflect.DeepEqual(reported, exp) {
+		t.Errorf("expected only %v to be reported but got %v", exp, reported)
+	}
+	exp := map[string]int{
+		`error "context canceled"`:        1,
+		`error "EOF"`:                     1,
+		`error "order already shipped"`:   1,
+		"type *fs.PathError":              1,
+		"class *bugsnag.discardTestError": 1,
+		"message /^connection reset/":     1,
+	}
+	if got := n.DiscardCounts(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected discard counts\n%v\nbut got\n%v", exp, got)
+	}
+
+	t.Run("invalid rules", func(t *testing.T) {
+		t.Parallel()
+		for _, cfg := range []Configuration{
+			{DiscardMessages: []string{"("}},
+			{DiscardErrorTypes: []error{nil}},
+		} {
+			cfg.APIKey, cfg.ReleaseStage, cfg.AppVersion = "abcd1234abcd1234abcd1234abcd1234", "dev", "1.2.3"
+			if _, err := New(cfg); err == nil {
+				t.Errorf("expected an error for %+v but got none", cfg)
+			}
+		}
+	})
+}
+
+type discardTestError struct{}
+
+func (*discardTestError) Error() string { return "discard me" }
@@ -0,0 +1,223 @@
+package bugsnag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configVars lists the variables read by ConfigurationFromVars, other than
+// lists, and how each variable populates the Configuration.
+//
+//nolint:gochecknoglobals // Treated as a constant lookup table.
+var configVars = []struct {
+	name string
+	set  func(cfg *Configuration, value string) error
+}{
+	{"BUGSNAG_API_KEY", func(cfg *Configuration, v string) error { cfg.APIKey = v; return nil }},
+	{"BUGSNAG_APP_VERSION", func(cfg *Configuration, v string) error { cfg.AppVersion = v; return nil }},
+	{"BUGSNAG_AUTO_APP_VERSION", boolVar(func(cfg *Configuration) *bool { return &cfg.AutoAppVersion })},
+	{"BUGSNAG_RELEASE_STAGE", func(cfg *Configuration, v string) error { cfg.ReleaseStage = v; return nil }},
+	{"BUGSNAG_SANITIZE_DISABLED_RELEASE_STAGES", boolVar(func(cfg *Configuration) *bool { return &cfg.SanitizeDisabledReleaseStages })},
+	{"BUGSNAG_NOTIFY_ENDPOINT", func(cfg *Configuration, v string) error { cfg.EndpointNotify = v; return nil }},
+	{"BUGSNAG_SESSIONS_ENDPOINT", func(cfg *Configuration, v string) error { cfg.EndpointSessions = v; return nil }},
+	{"BUGSNAG_MAX_BREADCRUMBS", intVar(func(cfg *Configuration) *int { return &cfg.MaxBreadcrumbs })},
+	{"BUGSNAG_MAX_BREADCRUMB_METADATA_BYTES", intVar(func(cfg *Configuration) *int { return &cfg.MaxBreadcrumbMetadataBytes })},
+	{"BUGSNAG_LEGACY_SERIALIZATION_FORMAT", boolVar(func(cfg *Configuration) *bool { return &cfg.LegacySerializationFormat })},
+	{"BUGSNAG_COMPRESS_SERIALIZED_DATA", boolVar(func(cfg *Configuration) *bool { return &cfg.CompressSerializedData })},
+	{"BUGSNAG_MAX_SERIALIZED_BYTES", intVar(func(cfg *Configuration) *int { return &cfg.MaxSerializedBytes })},
+	{"BUGSNAG_PROPAGATION_SIGNING_KEYS", func(cfg *Configuration, v string) error {
+		for _, encoded := range splitList(v) {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return errors.New("keys must be base64 encoded")
+			}
+			cfg.PropagationSigningKeys = append(cfg.PropagationSigningKeys, key)
+		}
+		return nil
+	}},
+	{"BUGSNAG_SESSION_PUBLISH_INTERVAL", func(cfg *Configuration, v string) error {
+		d, err := time.ParseDuration(v)
+		cfg.SessionPublishInterval = d
+		return err
+	}},
+	{"BUGSNAG_MAX_SESSIONS_PER_PAYLOAD", intVar(func(cfg *Configuration) *int { return &cfg.MaxSessionsPerPayload })},
+	{"BUGSNAG_SESSION_PER_PROCESS", boolVar(func(cfg *Configuration) *bool { return &cfg.SessionPerProcess })},
+}
+
+// listConfigVars lists the list variables read by ConfigurationFromVars, and
+// the list of the Configuration each variable populates.
+//
+//nolint:gochecknoglobals // Treated as a constant lookup table.
+var listConfigVars = []struct {
+	name  string
+	field func(cfg *Configuration) *[]string
+}{
+	{"BUGSNAG_ENABLED_RELEASE_STAGES", func(cfg *Configuration) *[]string { return &cfg.EnabledReleaseStages }},
+	{"BUGSNAG_TRUSTED_PROXY_HEADERS", func(cfg *Configuration) *[]string { return &cfg.TrustedProxyHeaders }},
+	{"BUGSNAG_REDACTED_KEYS", func(cfg *Configuration) *[]string { return &cfg.RedactedKeys }},
+	{"BUGSNAG_DISCARD_ERROR_CLASSES", func(cfg *Configuration) *[]string { return &cfg.DiscardErrorClasses }},
+	{"BUGSNAG_DISCARD_MESSAGES", func(cfg *Configuration) *[]string { return &cfg.DiscardMessages }},
+	{"BUGSNAG_PROPAGATED_METADATA_TABS", func(cfg *Configuration) *[]string { return &cfg.PropagatedMetadataTabs }},
+}
+
+func intVar(field func(cfg *Configuration) *int) func(cfg *Configuration, value string) error {
+	return func(cfg *Configuration, v string) error {
+		i, err := strconv.Atoi(v)
+		*field(cfg) = i
+		return err
+	}
+}
+
+func boolVar(field func(cfg *Configuration) *bool) func(cfg *Configuration, value string) error {
+	return func(cfg *Configuration, v string) error {
+		b, err := strconv.ParseBool(v)
+		*field(cfg) = b
+		return err
+	}
+}
+
+// splitList splits a comma separated list, ignoring surrounding whitespace
+// and empty elements.
+func splitList(value string) []string {
+	var list []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// ConfigurationFromEnv returns a Configuration populated from the BUGSNAG_*
+// environment variables, e.g. BUGSNAG_API_KEY. See ConfigurationFromVars for
+// the full list of variables.
+// The returned Configuration may be amended, e.g. with sanitizers, before
+// being passed to New, which validates it.
+func ConfigurationFromEnv() (Configuration, error) {
+	return ConfigurationFromVars(environ())
+}
+
+// ConfigurationFromFile returns a Configuration populated from the config
+// file at the given path, as read by ReadConfigFile, and from the BUGSNAG_*
+// environment variables, with the environment variables taking precedence.
+func ConfigurationFromFile(path string) (Configuration, error) {
+	vars, err := ReadConfigFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	for name, value := range environ() {
+		vars[name] = value
+	}
+	return ConfigurationFromVars(vars)
+}
+
+// ConfigurationFromVars returns a Configuration populated from the given
+// variables, keyed by name. Unset variables are ignored, as are empty
+// variables, except for lists: these are comma separated, and set to an
+// empty list if the variable is set but empty, e.g. to disable redaction
+// with BUGSNAG_REDACTED_KEYS="". Booleans are parsed with strconv.ParseBool
+// and durations with time.ParseDuration. The supported variables are:
+//
+//   - BUGSNAG_API_KEY
+//   - BUGSNAG_APP_VERSION, falling back to APP_VERSION
+//   - BUGSNAG_AUTO_APP_VERSION
+//   - BUGSNAG_RELEASE_STAGE
+//   - BUGSNAG_ENABLED_RELEASE_STAGES
+//   - BUGSNAG_SANITIZE_DISABLED_RELEASE_STAGES
+//   - BUGSNAG_NOTIFY_ENDPOINT
+//   - BUGSNAG_SESSIONS_ENDPOINT
+//   - BUGSNAG_TRUSTED_PROXY_HEADERS
+//   - BUGSNAG_MAX_BREADCRUMBS
+//   - BUGSNAG_MAX_BREADCRUMB_METADATA_BYTES
+//   - BUGSNAG_REDACTED_KEYS
+//   - BUGSNAG_DISCARD_ERROR_CLASSES
+//   - BUGSNAG_DISCARD_MESSAGES, as regular expressions without commas
+//   - BUGSNAG_LEGACY_SERIALIZATION_FORMAT
+//   - BUGSNAG_COMPRESS_SERIALIZED_DATA
+//   - BUGSNAG_MAX_SERIALIZED_BYTES
+//   - BUGSNAG_PROPAGATED_METADATA_TABS
+//   - BUGSNAG_PROPAGATION_SIGNING_KEYS, as base64 encoded keys
+//   - BUGSNAG_SESSION_PUBLISH_INTERVAL
+//   - BUGSNAG_MAX_SESSIONS_PER_PAYLOAD
+//   - BUGSNAG_SESSION_PER_PROCESS
+//
+// An error is returned if any variable has an invalid value.
+func ConfigurationFromVars(vars map[string]string) (Configuration, error) {
+	cfg := Configuration{AppVersion: vars["APP_VERSION"]}
+	for _, v := range configVars {
+		value := strings.TrimSpace(vars[v.name])
+		if value == "" {
+			continue
+		}
+		if err := v.set(&cfg, value); err != nil {
+			return Configuration{}, fmt.Errorf("invalid value of %s %q: %w", v.name, value, err)
+		}
+	}
+	for _, v := range listConfigVars {
+		value, ok := vars[v.name]
+		if !ok {
+			continue
+		}
+		list := splitList(value)
+		if list == nil {
+			// Distinguish an empty list from the default of a nil list.
+			list = []string{}
+		}
+		*v.field(&cfg) = list
+	}
+	return cfg, nil
+}
+
+// ReadConfigFile reads the variables in the config file at the given path.
+// The file lists one NAME=VALUE pair per line, using the same variable names
+// as ConfigurationFromVars. Blank lines and lines starting with # are
+// ignored, and values may be wrapped in double quotes:
+//
+//	# Production configuration
+//	BUGSNAG_API_KEY=abcd1234abcd1234abcd1234abcd1234
+//	BUGSNAG_RELEASE_STAGE="production"
+func ReadConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE but got %q", path, line, text)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			value = unquoted
+		}
+		vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	return vars, nil
+}
+
+// environ returns the environment variables keyed by name.
+func environ() map[string]string {
+	vars := map[string]string{}
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars[name] = value
+		}
+	}
+	return vars
+}
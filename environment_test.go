@@ -0,0 +1,152 @@
+package bugsnag
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigurationFromVars(t *testing.T) {
+	t.Parallel()
+
+	t.Run("all variables", func(t *testing.T) {
+		t.Parallel()
+		got, err := ConfigurationFromVars(map[string]string{
+			"BUGSNAG_API_KEY":                          "abcd1234abcd1234abcd1234abcd1234",
+			"BUGSNAG_APP_VERSION":                      "1.2.3",
+			"APP_VERSION":                              "0.0.1",
+			"BUGSNAG_AUTO_APP_VERSION":                 "true",
+			"BUGSNAG_RELEASE_STAGE":                    "production",
+			"BUGSNAG_ENABLED_RELEASE_STAGES":           "staging,production",
+			"BUGSNAG_SANITIZE_DISABLED_RELEASE_STAGES": "true",
+			"BUGSNAG_NOTIFY_ENDPOINT":                  "https://notify.example.com",
+			"BUGSNAG_SESSIONS_ENDPOINT":                "https://sessions.example.com",
+			"BUGSNAG_TRUSTED_PROXY_HEADERS":            "X-Forwarded-For, X-Real-Ip",
+			"BUGSNAG_MAX_BREADCRUMBS":                  "50",
+			"BUGSNAG_MAX_BREADCRUMB_METADATA_BYTES":    "-1",
+			"BUGSNAG_REDACTED_KEYS":                    "password, /^x-.*-key$/",
+			"BUGSNAG_DISCARD_ERROR_CLASSES":            "*net.OpError",
+			"BUGSNAG_DISCARD_MESSAGES":                 "^EOF$, connection reset",
+			"BUGSNAG_LEGACY_SERIALIZATION_FORMAT":      "false",
+			"BUGSNAG_COMPRESS_SERIALIZED_DATA":         "true",
+			"BUGSNAG_MAX_SERIALIZED_BYTES":             "8192",
+			"BUGSNAG_PROPAGATED_METADATA_TABS":         "app,tenant",
+			"BUGSNAG_PROPAGATION_SIGNING_KEYS":         "bmV3,b2xk",
+			"BUGSNAG_SESSION_PUBLISH_INTERVAL":         "30s",
+			"BUGSNAG_MAX_SESSIONS_PER_PAYLOAD":         "100",
+			"BUGSNAG_SESSION_PER_PROCESS":              "true",
+			"UNRELATED":                                "ignored",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := Configuration{
+			APIKey:                        "abcd1234abcd1234abcd1234abcd1234",
+			AppVersion:                    "1.2.3",
+			AutoAppVersion:                true,
+			ReleaseStage:                  "production",
+			EnabledReleaseStages:          []string{"staging", "production"},
+			SanitizeDisabledReleaseStages: true,
+			EndpointNotify:                "https://notify.example.com",
+			EndpointSessions:              "https://sessions.example.com",
+			TrustedProxyHeaders:           []string{"X-Forwarded-For", "X-Real-Ip"},
+			MaxBreadcrumbs:                50,
+			MaxBreadcrumbMetadataBytes:    -1,
+			RedactedKeys:                  []string{"password", "/^x-.*-key$/"},
+			DiscardErrorClasses:           []string{"*net.OpError"},
+			DiscardMessages:               []string{"^EOF$", "connection reset"},
+			CompressSerializedData:        true,
+			MaxSerializedBytes:            8192,
+			PropagatedMetadataTabs:        []string{"app", "tenant"},
+			PropagationSigningKeys:        [][]byte{[]byte("new"), []byte("old")},
+			SessionPublishInterval:        30 * time.Second,
+			MaxSessionsPerPayload:         100,
+			SessionPerProcess:             true,
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("expected\n%+v\nbut got\n%+v", exp, got)
+		}
+	})
+
+	t.Run("app version fallback", func(t *testing.T) {
+		t.Parallel()
+		got, err := ConfigurationFromVars(map[string]string{"APP_VERSION": "0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AppVersion != "0.0.1" {
+			t.Errorf("expected APP_VERSION to be used but got '%s'", got.AppVersion)
+		}
+	})
+
+	t.Run("empty variables", func(t *testing.T) {
+		t.Parallel()
+		got, err := ConfigurationFromVars(map[string]string{
+			"BUGSNAG_API_KEY":                  "",
+			"BUGSNAG_MAX_BREADCRUMBS":          "",
+			"BUGSNAG_REDACTED_KEYS":            "",
+			"BUGSNAG_PROPAGATED_METADATA_TABS": " , ",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := Configuration{RedactedKeys: []string{}, PropagatedMetadataTabs: []string{}}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("expected empty lists to be set and other variables to be ignored but got %+v", got)
+		}
+	})
+
+	for _, name := range []string{
+		"BUGSNAG_MAX_BREADCRUMBS",
+		"BUGSNAG_COMPRESS_SERIALIZED_DATA",
+		"BUGSNAG_PROPAGATION_SIGNING_KEYS",
+		"BUGSNAG_SESSION_PUBLISH_INTERVAL",
+	} {
+		t.Run("invalid "+name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ConfigurationFromVars(map[string]string{name: "not valid!"})
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("expected an error mentioning %s but got %v", name, err)
+			}
+		})
+	}
+}
+
+func TestConfigurationFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bugsnag.env")
+	file := `
+# Comments and blank lines are ignored
+
+BUGSNAG_API_KEY = abcd1234abcd1234abcd1234abcd1234
+BUGSNAG_RELEASE_STAGE="staging"
+BUGSNAG_APP_VERSION=1.0.0
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BUGSNAG_APP_VERSION", "2.0.0")
+
+	got, err := ConfigurationFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.APIKey != "abcd1234abcd1234abcd1234abcd1234" || got.ReleaseStage != "staging" {
+		t.Errorf("expected the values of the file but got %+v", got)
+	}
+	if got.AppVersion != "2.0.0" {
+		t.Errorf("expected the environment to take precedence but got '%s'", got.AppVersion)
+	}
+
+	if err := os.WriteFile(path, []byte("BUGSNAG_API_KEY\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConfigurationFromFile(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("expected an error with the line number but got %v", err)
+	}
+	if _, err := ConfigurationFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file but got none")
+	}
+}
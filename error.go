@@ -18,15 +18,18 @@ import (
 // be one of SeverityInfo, SeverityWarning, and SeverityError. The default
 // severity for unhandled or panicking Errors is "error", and "warning"
 // otherwise.
+// These properties may also be set when calling Wrap, by passing in the
+// ErrorOptions returned from WithSeverity, AsUnhandled, and AsPanic.
 type Error struct {
 	Unhandled bool
 	Panic     bool
-	Severity  severity
+	Severity  Severity
 
-	err        error
-	ctx        context.Context //nolint:containedctx // We're storing it for valid reasons
-	stacktrace []*JSONStackframe
-	msg        string
+	err            error
+	ctx            context.Context //nolint:containedctx // We're storing it for valid reasons
+	stacktrace     []*JSONStackframe
+	msg            string
+	severityReason string
 }
 
 func (e *Error) Error() string {
@@ -51,6 +54,40 @@ func (e *Error) Unwrap() error {
 	return e.err
 }
 
+// ErrorOption configures the *Error returned from Wrap. ErrorOptions may be
+// passed to Wrap anywhere among the message and format arguments, and are
+// applied in the order given.
+type ErrorOption func(*Error)
+
+// WithSeverity returns an ErrorOption that sets the Severity of the wrapped
+// Error.
+func WithSeverity(severity Severity) ErrorOption {
+	return func(e *Error) { e.Severity = severity }
+}
+
+// AsUnhandled returns an ErrorOption that marks the wrapped Error as
+// unhandled. See the Unhandled field of Error for more details.
+func AsUnhandled() ErrorOption {
+	return func(e *Error) { e.Unhandled = true }
+}
+
+// AsPanic returns an ErrorOption that marks the wrapped Error as a panic. See
+// the Panic field of Error for more details.
+func AsPanic() ErrorOption {
+	return func(e *Error) { e.Panic = true }
+}
+
+// WithSeverityReason returns an ErrorOption that overrides the reason for the
+// severity of the reported error, which is otherwise derived from the Unhandled,
+// Panic, and Severity fields. See JSONSeverityReason for the accepted values,
+// e.g. "log" for errors reported as part of a log call.
+// Unlike the other properties of Error, this takes precedence over any
+// *Error wrapped further down the chain, along with any severity set on the
+// same Error.
+func WithSeverityReason(reason string) ErrorOption {
+	return func(e *Error) { e.severityReason = reason }
+}
+
 // Wrap attaches ctx data and wraps the given error with message, and
 // associates a stacktrace to the error based on the frame at which Wrap was
 // called.
@@ -67,18 +104,23 @@ func (n *Notifier) Wrap(ctx context.Context, err error, msgAndFmtArgs ...interfa
 // called.
 // Any attached diagnostic data from this ctx will be preserved should you
 // return the returned error further up the stack.
+// Any ErrorOption values in msgAndFmtArgs are applied to the returned Error
+// and are not considered part of the message:
+//
+//	err := bugsnag.Wrap(ctx, err, "unable to foo %s", "bar", bugsnag.AsUnhandled(), bugsnag.AsPanic())
 func Wrap(ctx context.Context, err error, msgAndFmtArgs ...interface{}) *Error {
 	if ctx == nil && err == nil && msgAndFmtArgs == nil {
 		return nil
 	}
 
+	opts, msgAndFmtArgs := extractErrorOptions(msgAndFmtArgs)
 	message := ""
 	if l := len(msgAndFmtArgs); l > 0 {
 		if msg, ok := msgAndFmtArgs[0].(string); ok {
 			message = fmt.Sprintf(msg, msgAndFmtArgs[1:]...)
 		}
 	}
-	return &Error{
+	berr := &Error{
 		Unhandled:  false,
 		Panic:      false,
 		Severity:   severityUndetermined,
@@ -87,6 +129,29 @@ func Wrap(ctx context.Context, err error, msgAndFmtArgs ...interface{}) *Error {
 		stacktrace: makeStacktrace(makeModulePath()),
 		msg:        message,
 	}
+	for _, opt := range opts {
+		opt(berr)
+	}
+	return berr
+}
+
+// extractErrorOptions separates any ErrorOptions from the message and format
+// args given to Wrap, preserving the order of the remaining args.
+func extractErrorOptions(args []interface{}) ([]ErrorOption, []interface{}) {
+	var (
+		opts []ErrorOption
+		rest = make([]interface{}, 0, len(args))
+	)
+	for _, arg := range args {
+		if opt, ok := arg.(ErrorOption); ok {
+			if opt != nil {
+				opts = append(opts, opt)
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return opts, rest
 }
 
 func makeStacktrace(module string) []*JSONStackframe {
@@ -19,6 +19,8 @@ func TestSeverityReasonType(t *testing.T) {
 		{exp: "unhandledPanic", err: Error{Unhandled: true, Panic: true}},
 		{exp: "userSpecifiedSeverity", err: Error{Severity: SeverityError}},
 		{exp: "userSpecifiedSeverity", err: Error{Severity: SeverityError, Unhandled: true, Panic: true}},
+		{exp: "log", err: Error{Severity: SeverityError, severityReason: "log"}},
+		{exp: "log", err: Error{err: &Error{Severity: SeverityInfo, Unhandled: true}, severityReason: "log"}},
 	} {
 		t.Run(tc.exp, func(t *testing.T) {
 			t.Parallel()
@@ -118,3 +120,90 @@ func TestWrap(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapWithOptions(t *testing.T) {
+	t.Parallel()
+	err := errors.New("something bad happened")
+
+	for _, tc := range []struct {
+		name         string
+		args         []interface{}
+		expErrString string
+		expSeverity  Severity
+		expUnhandled bool
+		expPanic     bool
+	}{
+		{name: "no options", args: nil, expErrString: err.Error()},
+		{
+			name:         "only options",
+			args:         []interface{}{WithSeverity(SeverityInfo), AsUnhandled(), AsPanic()},
+			expErrString: err.Error(),
+			expSeverity:  SeverityInfo,
+			expUnhandled: true,
+			expPanic:     true,
+		},
+		{
+			name:         "options after message and args",
+			args:         []interface{}{"I got %d", 1, AsUnhandled()},
+			expErrString: "I got 1: " + err.Error(),
+			expUnhandled: true,
+		},
+		{
+			name:         "options before message and args",
+			args:         []interface{}{AsPanic(), "I got %d", 1},
+			expErrString: "I got 1: " + err.Error(),
+			expPanic:     true,
+		},
+		{
+			name:         "later options take precedence",
+			args:         []interface{}{WithSeverity(SeverityInfo), "oops", WithSeverity(SeverityError)},
+			expErrString: "oops: " + err.Error(),
+			expSeverity:  SeverityError,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			wrapped := Wrap(context.Background(), err, tc.args...)
+			if exp, got := tc.expErrString, wrapped.Error(); exp != got {
+				t.Errorf("unexpected error message,\nexp: %s\ngot: %s", exp, got)
+			}
+			if exp, got := tc.expSeverity, wrapped.Severity; exp != got {
+				t.Errorf("expected severity '%s' but got '%s'", exp, got)
+			}
+			if exp, got := tc.expUnhandled, wrapped.Unhandled; exp != got {
+				t.Errorf("expected Unhandled to be %v but was %v", exp, got)
+			}
+			if exp, got := tc.expPanic, wrapped.Panic; exp != got {
+				t.Errorf("expected Panic to be %v but was %v", exp, got)
+			}
+		})
+	}
+}
+
+func TestSeverityString(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		severity Severity
+		exp      string
+	}{
+		{severity: severityUndetermined, exp: "undetermined"},
+		{severity: SeverityInfo, exp: "info"},
+		{severity: SeverityWarning, exp: "warning"},
+		{severity: SeverityError, exp: "error"},
+		{severity: Severity(42), exp: "undetermined"},
+	} {
+		t.Run(tc.exp, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.severity.String(); got != tc.exp {
+				t.Errorf("expected severity string '%s' but got '%s'", tc.exp, got)
+			}
+			b, err := tc.severity.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tc.exp {
+				t.Errorf("expected marshalled severity '%s' but got '%s'", tc.exp, got)
+			}
+		})
+	}
+}
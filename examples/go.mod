@@ -4,10 +4,13 @@ go 1.22.4
 
 replace github.com/kinbiko/bugsnag => ../
 
+replace github.com/kinbiko/bugsnag/bugsnaggrpc => ../bugsnaggrpc
+
 require (
 	github.com/DataDog/datadog-go v4.8.3+incompatible
 	github.com/golang/protobuf v1.5.4
 	github.com/kinbiko/bugsnag v0.0.0
+	github.com/kinbiko/bugsnag/bugsnaggrpc v0.0.0
 	github.com/sirupsen/logrus v1.9.3
 	google.golang.org/grpc v1.64.0
 )
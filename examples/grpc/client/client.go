@@ -7,10 +7,10 @@ import (
 	"time"
 
 	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnaggrpc"
 	pb "github.com/kinbiko/bugsnag/examples/grpc/comments"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 type application struct {
@@ -27,7 +27,9 @@ func Run() {
 
 	app := &application{ntf: notifier}
 
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithBlock())
+	// The bugsnaggrpc interceptor propagates the diagnostic data in the ctx of
+	// each call to the server.
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithBlock(), grpc.WithUnaryInterceptor(bugsnaggrpc.UnaryClientInterceptor(notifier)))
 	if err != nil {
 		panic(err)
 	}
@@ -53,7 +55,6 @@ func (a *application) callServer(ctx context.Context, client pb.CommentServiceCl
 	ctx = a.ntf.WithBugsnagContext(ctx, "users/123/comments") // Pretend that this is a HTTP endpoint that initiated the gRPC call
 	ctx = a.ntf.WithMetadata(ctx, "gRPC", map[string]interface{}{"client": "comments"})
 	ctx = a.ntf.WithUser(ctx, bugsnag.User{ID: "123", Name: "River Tam", Email: "river@serentiy.space"})
-	ctx = metadata.AppendToOutgoingContext(ctx, "bugsnag-diagnostics", string(a.ntf.Serialize(ctx)))
 
 	fmt.Println("invoking GetComment")
 	_, _ = client.GetComment(ctx, &pb.GetCommentReq{Id: "123"})
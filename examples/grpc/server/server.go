@@ -7,10 +7,10 @@ import (
 	"os"
 
 	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnaggrpc"
 	pb "github.com/kinbiko/bugsnag/examples/grpc/comments"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 func Run() {
@@ -25,34 +25,10 @@ func Run() {
 	s.gRPCStart()
 }
 
-func (s *server) bugsnagMiddleware(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
-	ctx = s.WithMetadatum(ctx, "app", "id", "comments-server")
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		ctx = s.Deserialize(ctx, []byte(md["bugsnag-diagnostics"][0]))
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("%v", r)
-			if recErr, ok := r.(error); ok {
-				err = recErr
-			}
-			bErr := bugsnag.Wrap(ctx, err)
-			bErr.Unhandled = true
-			bErr.Panic = true
-			// Be careful not to pass in the ctx from the gRPC call to Notify,
-			// as this context is likely cancelled by the time the notifier
-			// makes the HTTP request to Bugsnag's servers.
-			// All the values in the ctx are attached as part of s.Wrap above.
-			s.Notify(context.Background(), bErr)
-			err = bErr
-		}
-	}()
-
-	res, err = handler(ctx, req)
-	if err != nil {
-		s.Notify(ctx, s.Wrap(ctx, err))
-	}
-	return res, err
+// appMetadata demonstrates how to attach additional diagnostic data in an
+// interceptor that runs after the bugsnaggrpc interceptor.
+func (s *server) appMetadata(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(s.WithMetadatum(ctx, "app", "id", "comments-server"), req)
 }
 
 func (s *server) gRPCStart() {
@@ -61,7 +37,9 @@ func (s *server) gRPCStart() {
 	if err != nil {
 		panic("unable to open port " + port)
 	}
-	srv := grpc.NewServer(grpc.UnaryInterceptor(s.bugsnagMiddleware))
+	// The bugsnaggrpc interceptor attaches diagnostic data propagated by the
+	// client, starts a session, and reports panics and errors.
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(bugsnaggrpc.UnaryServerInterceptor(s.Notifier), s.appMetadata))
 	pb.RegisterCommentServiceServer(srv, s)
 	if err := srv.Serve(lis); err != nil {
 		panic("failed to serve gRPC: " + err.Error())
@@ -1,14 +1,13 @@
 package nethttp
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
 
 	"github.com/kinbiko/bugsnag"
+	"github.com/kinbiko/bugsnag/bugsnaghttp"
 )
 
 type server struct{ *bugsnag.Notifier }
@@ -23,7 +22,18 @@ func Run() {
 		panic(err)
 	}
 	s := &server{Notifier: n}
-	http.ListenAndServe(":8080", s.withRequestMetadata(withPanicReporting(s.Notifier, s.HandleCommentsGet())))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /comments", s.HandleCommentsGet())
+
+	// The middleware starts a session per request, attaches the request data
+	// and route to the request's context, and reports panics as unhandled
+	// errors.
+	// NOTE: **you** are responsible for ensuring that you're not sending
+	// sensitive information, although values of keys matching
+	// Configuration.RedactedKeys are redacted.
+	middleware := bugsnaghttp.Middleware(n, bugsnaghttp.WithServerErrorReporting())
+	http.ListenAndServe(":8080", middleware(mux))
 }
 
 func (s *server) HandleCommentsGet() http.HandlerFunc {
@@ -40,48 +50,3 @@ func (s *server) HandleCommentsGet() http.HandlerFunc {
 		s.Notify(ctx, s.Wrap(ctx, fmt.Errorf("nature must wait!")))
 	}
 }
-
-func (s *server) withRequestMetadata(h http.Handler) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		bytes, _ := ioutil.ReadAll(r.Body)
-		body := map[string]interface{}{}
-		json.Unmarshal(bytes, &body)
-		// NOTE: **you** are responsible for ensuring that you're not sending
-		// sensitive information.
-		request := map[string]interface{}{
-			"body":    body,
-			"headers": r.Header,
-			"url":     r.URL,
-			"method":  r.Method,
-		}
-		if r.Method == http.MethodGet {
-			delete(request, "body")
-		}
-		ctx := s.WithMetadata(r.Context(), "request", request)
-
-		h.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-func withPanicReporting(n *bugsnag.Notifier, h http.Handler) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := n.StartSession(r.Context())
-		defer func() {
-			if rec := recover(); rec != nil {
-				// Note: could additionally check if the panic reported is an
-				// error, and then wrap here. It would add more value, but in
-				// this case you're probably doing error handling in an
-				// unidiomatic manner anyway.
-				err := bugsnag.Wrap(ctx, fmt.Errorf("%v", rec), "panic in HTTP handler")
-				err.Unhandled = true
-				err.Panic = true
-				// Note: passing in context.Background() here so that we're
-				// guaranteed that the payload isn't dropped due to a
-				// timeout/deadline on the HTTP request context.
-				n.Notify(context.Background(), err)
-			}
-		}()
-
-		h.ServeHTTP(w, r)
-	})
-}
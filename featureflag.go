@@ -0,0 +1,70 @@
+package bugsnag
+
+import (
+	"context"
+	"sort"
+)
+
+// WithFeatureFlag attaches the given feature flag, and the variant of the
+// flag in use, to the given context, such that errors reported with this
+// context can be correlated with the flags that were active at the time.
+// The variant is optional, and attaching the same flag again overwrites the
+// variant of the previous one.
+// Flags are propagated to other services via Serialize.
+func (n *Notifier) WithFeatureFlag(ctx context.Context, name, variant string) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	return withContextData(ctx, func(cd *ctxData) {
+		flags := make(map[string]string, len(cd.FeatureFlags)+1)
+		for k, v := range cd.FeatureFlags {
+			flags[k] = v
+		}
+		flags[name] = variant
+		cd.FeatureFlags = flags
+	})
+}
+
+// ClearFeatureFlag removes the feature flag with the given name from the
+// given context, if present.
+// Note that flags attached to the context of an error passed to Wrap are
+// still reported, as flags are merged across these contexts like metadata.
+func (n *Notifier) ClearFeatureFlag(ctx context.Context, name string) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	if _, ok := getAttachedContextData(ctx).FeatureFlags[name]; !ok {
+		return ctx
+	}
+	return withContextData(ctx, func(cd *ctxData) {
+		flags := make(map[string]string, len(cd.FeatureFlags))
+		for k, v := range cd.FeatureFlags {
+			if k != name {
+				flags[k] = v
+			}
+		}
+		cd.FeatureFlags = flags
+	})
+}
+
+// makeFeatureFlags returns the given flags sorted by name, for a predictable
+// payload.
+func makeFeatureFlags(flags map[string]string) []*JSONFeatureFlag {
+	if len(flags) == 0 {
+		return nil
+	}
+	payloads := make([]*JSONFeatureFlag, 0, len(flags))
+	for name, variant := range flags {
+		payloads = append(payloads, &JSONFeatureFlag{FeatureFlag: name, Variant: variant})
+	}
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].FeatureFlag < payloads[j].FeatureFlag })
+	return payloads
+}
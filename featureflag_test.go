@@ -0,0 +1,63 @@
+package bugsnag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/kinbiko/jsonassert"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asJSON := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	t.Run("flags are reported sorted by name, merged across Wrap contexts", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithFeatureFlag(context.Background(), "new-checkout", "control")
+		ctx = n.WithFeatureFlag(ctx, "dark-mode", "")
+		ctx = n.WithFeatureFlag(ctx, "removed", "on")
+		ctx = n.ClearFeatureFlag(ctx, "removed")
+		inner := n.WithFeatureFlag(ctx, "new-checkout", "treatment")
+		inner = n.WithFeatureFlag(inner, "beta-search", "v2")
+
+		report, _ := n.makeReport(ctx, Wrap(inner, errors.New("oops")))
+		jsonassert.New(t).Assertf(asJSON(report.Events[0].FeatureFlags), `[
+			{ "featureFlag": "beta-search", "variant": "v2" },
+			{ "featureFlag": "dark-mode" },
+			{ "featureFlag": "new-checkout", "variant": "treatment" }
+		]`)
+		if got := getAttachedContextData(ctx).FeatureFlags["new-checkout"]; got != "control" {
+			t.Errorf("expected the variant of the outer context to be unchanged but got '%s'", got)
+		}
+	})
+
+	t.Run("flags are serialized", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithFeatureFlag(context.Background(), "new-checkout", "treatment")
+		got := getAttachedContextData(n.Deserialize(context.Background(), n.Serialize(ctx))).FeatureFlags
+		if len(got) != 1 || got["new-checkout"] != "treatment" {
+			t.Errorf("expected the feature flag to be serialized but got %v", got)
+		}
+	})
+
+	t.Run("no flags", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.ClearFeatureFlag(context.Background(), "missing")
+		report, _ := n.makeReport(ctx, errors.New("oops"))
+		if got := report.Events[0].FeatureFlags; got != nil {
+			t.Errorf("expected no feature flags but got %v", got)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+// Package bugsnagtest provides helpers for testing the packages that
+// integrate the notifier with other libraries.
+package bugsnagtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/kinbiko/bugsnag"
+)
+
+// Reports records the error reports that would otherwise have been sent to
+// Bugsnag.
+type Reports struct {
+	mu       sync.Mutex
+	payloads []*bugsnag.JSONErrorReport
+}
+
+// Get returns the error reports recorded so far.
+func (r *Reports) Get() []*bugsnag.JSONErrorReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.payloads
+}
+
+// NewNotifier returns a notifier that records the error reports it would
+// otherwise have sent to Bugsnag, and doesn't send any session reports.
+// The notifier is closed once the test completes.
+func NewNotifier(t testing.TB) (*bugsnag.Notifier, *Reports) {
+	t.Helper()
+	reps := &Reports{}
+	n, err := bugsnag.New(bugsnag.Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		AppVersion:   "1.2.3",
+		ReleaseStage: "test",
+		ErrorReportSanitizer: func(_ context.Context, p *bugsnag.JSONErrorReport) error {
+			reps.mu.Lock()
+			defer reps.mu.Unlock()
+			reps.payloads = append(reps.payloads, p)
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+		SessionReportSanitizer: func(_ *bugsnag.JSONSessionReport) error {
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+	return n, reps
+}
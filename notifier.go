@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os/exec"
 	"reflect"
@@ -21,14 +22,18 @@ import (
 type Notifier struct {
 	cfg *Configuration
 
-	sessions               []*session
-	sessionPublishInterval time.Duration
+	sessions *sessionGroups
+	// processSession is the session started by New if SessionPerProcess is
+	// configured.
+	processSession *session
 
 	reportCh       chan *JSONErrorReport
 	sessionCh      chan *session
 	shutdownCh     chan struct{}
 	shutdownDoneCh chan struct{}
 	loopOnce       sync.Once
+
+	discardRules []*discardRule
 }
 
 // ErrorReportSanitizer allows you to modify the payload being sent to Bugsnag just before it's being sent.
@@ -46,18 +51,32 @@ func New(config Configuration) (*Notifier, error) { //nolint:gocritic // We want
 	cfg := &config
 	cfg.populateDefaults()
 	cfg.runtimeConstants = makeRuntimeConstants()
+	if cfg.AutoAppVersion && cfg.AppVersion == "" {
+		cfg.AppVersion = cfg.runtimeConstants.autoAppVersion()
+		if cfg.AppVersion == "" {
+			return nil, errors.New("unable to determine the app version from the build info, please set AppVersion")
+		}
+	}
 
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
+	redactor, err := makeRedactor(cfg.RedactedKeys)
+	if err != nil {
+		return nil, err
+	}
+	cfg.redactor = redactor
+	discardRules, err := makeDiscardRules(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	const bufChanSize = 16
 
-	return &Notifier{
+	n := &Notifier{
 		cfg: cfg,
 
-		sessions:               []*session{},
-		sessionPublishInterval: time.Minute,
+		sessions: &sessionGroups{},
 
 		sessionCh: make(chan *session, bufChanSize),
 		reportCh:  make(chan *JSONErrorReport, bufChanSize),
@@ -66,7 +85,13 @@ func New(config Configuration) (*Notifier, error) { //nolint:gocritic // We want
 		shutdownDoneCh: make(chan struct{}),
 
 		loopOnce: sync.Once{},
-	}, nil
+
+		discardRules: discardRules,
+	}
+	if cfg.SessionPerProcess {
+		n.processSession = n.startSession(context.Background())
+	}
+	return n, nil
 }
 
 // Close shuts down the notifier, flushing any unsent reports and sessions.
@@ -93,6 +118,9 @@ func (n *Notifier) Close() {
 // Extracts diagnostic data from the context and any *bugsnag.Error errors,
 // including wrapped errors.
 // Invokes the ErrorReportSanitizer, if set, before sending the error report.
+// Does nothing if the release stage isn't one of the EnabledReleaseStages, or
+// if the error matches any of the discard rules of the Configuration, see
+// DiscardCounts.
 func (n *Notifier) Notify(ctx context.Context, err error) {
 	// Ideally we wouldn't need this guard, but it's the best way I can see to
 	// prevent this package from ever panicking.
@@ -102,6 +130,13 @@ func (n *Notifier) Notify(ctx context.Context, err error) {
 		n.cfg.InternalErrorCallback(errors.New("error missing in call to (*bugsnag.Notifier).Notify. no error reported to Bugsnag"))
 		return
 	}
+	if n.discard(err) {
+		return
+	}
+	enabled := n.cfg.releaseStageEnabled()
+	if !enabled && !n.cfg.SanitizeDisabledReleaseStages {
+		return
+	}
 	n.loopOnce.Do(func() { go n.loop() })
 
 	var report *JSONErrorReport
@@ -110,13 +145,22 @@ func (n *Notifier) Notify(ctx context.Context, err error) {
 		n.cfg.InternalErrorCallback(sErr)
 		return
 	}
-	n.reportCh <- report
+	// Redact again, as the sanitizer may have added data, e.g. span attributes.
+	for _, event := range report.Events {
+		n.cfg.redactor.redactEvent(event)
+	}
+	if enabled {
+		n.reportCh <- report
+	}
 }
 
-type severity int
+// Severity represents the severity of an Error, as shown in the Bugsnag
+// dashboard. The zero value indicates that the severity should be determined
+// automatically based on the Unhandled and Panic flags of the Error.
+type Severity int
 
 const (
-	severityUndetermined severity = iota
+	severityUndetermined Severity = iota
 	// SeverityInfo indicates that the severity of the Error is "info"
 	SeverityInfo
 	// SeverityWarning indicates that the severity of the Error is "warning"
@@ -125,20 +169,38 @@ const (
 	SeverityError
 )
 
+// String returns the representation of the severity as expected by the
+// Bugsnag API, e.g. "warning".
+func (s Severity) String() string {
+	if s < severityUndetermined || s > SeverityError {
+		return "undetermined"
+	}
+	return []string{"undetermined", "info", "warning", "error"}[s]
+}
+
+// MarshalText implements encoding.TextMarshaler, such that a Severity is
+// represented as its string value when marshalled into JSON etc.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 // loop is intended to be an infinitely running goroutine that periodically (as
-// defined by sessionPublishInterval) sends sessions, and sends reports as they
+// defined by Configuration.SessionPublishInterval) sends sessions, and sends reports as they
 // come in. This loop ensures that a spike in errors doesn't consume the upload
 // bandwidth for highly concurrent applications.
 func (n *Notifier) loop() {
-	ticker := time.NewTicker(n.sessionPublishInterval)
+	ticker := time.NewTicker(n.cfg.SessionPublishInterval)
 	for {
 		select {
 		case r := <-n.reportCh:
 			if err := n.sendErrorReport(r); err != nil {
 				n.cfg.InternalErrorCallback(fmt.Errorf("unable to send error report: %w", err))
 			}
-		case s := <-n.sessionCh:
-			n.sessions = append(n.sessions, s)
+		case sess := <-n.sessionCh:
+			n.sessions.add(sess)
+			if limit := n.cfg.MaxSessionsPerPayload; limit > 0 && n.sessions.total >= limit {
+				n.flushSessions()
+			}
 		case <-ticker.C:
 			n.flushSessions()
 		case <-n.shutdownCh:
@@ -160,8 +222,8 @@ func (n *Notifier) shutdown(ticker *time.Ticker) {
 	}
 
 	close(n.sessionCh)
-	for s := range n.sessionCh {
-		n.sessions = append(n.sessions, s)
+	for sess := range n.sessionCh {
+		n.sessions.add(sess)
 	}
 
 	ticker.Stop()
@@ -175,31 +237,69 @@ type causer interface {
 func (n *Notifier) makeReport(ctx context.Context, err error) (*JSONErrorReport, context.Context) {
 	unhandled := makeUnhandled(err)
 	exs := makeExceptions(err)
-	contextData, augmentedCtx := extractAugmentedContextData(ctx, err, unhandled)
+	contextData, augmentedCtx := extractAugmentedContextData(ctx, err)
+	n.limitBreadcrumbs(contextData)
+	if contextData.sess == nil {
+		contextData.sess = n.processSession
+	}
+	// Only count the event against the session once all contexts have been
+	// visited, as the contexts are likely to share the same session.
+	contextData.session = makeJSONSession(contextData.sess, unhandled)
+	if n.cfg.AutoAppVersion {
+		contextData.metadata = withVCSMetadata(contextData.metadata, n.cfg.runtimeConstants.vcsMetadata())
+	}
+	correlation := n.makeCorrelation(augmentedCtx)
+	if correlation == nil {
+		correlation = n.makeCorrelation(ctx)
+	}
+	if correlation != nil {
+		contextData.metadata = withMetadataTab(contextData.metadata, "trace", map[string]interface{}{
+			"traceId": correlation.TraceID,
+			"spanId":  correlation.SpanID,
+		})
+	}
+	event := &JSONEvent{
+		PayloadVersion: "5",
+		Context:        contextData.bContext,
+		Unhandled:      unhandled,
+		Severity:       makeSeverity(err),
+		SeverityReason: &JSONSeverityReason{Type: severityReasonType(err)},
+		Exceptions:     exs,
+		Breadcrumbs:    contextData.breadcrumbs,
+		Request:        contextData.request,
+		User:           contextData.user,
+		App:            makeJSONApp(n.cfg),
+		Device:         n.makeJSONDevice(),
+		Session:        contextData.session,
+		Correlation:    correlation,
+		Metadata:       contextData.metadata,
+		FeatureFlags:   makeFeatureFlags(contextData.featureFlags),
+		GroupingHash:   makeGroupingHash(exs),
+	}
+	n.cfg.redactor.redactEvent(event)
 	return &JSONErrorReport{
 		APIKey:   n.cfg.APIKey,
 		Notifier: makeNotifier(n.cfg),
-		Events: []*JSONEvent{
-			{
-				PayloadVersion: "5",
-				Context:        contextData.bContext,
-				Unhandled:      unhandled,
-				Severity:       makeSeverity(err),
-				SeverityReason: &JSONSeverityReason{Type: severityReasonType(err)},
-				Exceptions:     exs,
-				Breadcrumbs:    contextData.breadcrumbs,
-				User:           contextData.user,
-				App:            makeJSONApp(n.cfg),
-				Device:         n.makeJSONDevice(),
-				Session:        contextData.session,
-				Metadata:       contextData.metadata,
-				GroupingHash:   makeGroupingHash(exs),
-			},
-		},
+		Events:   []*JSONEvent{event},
 	}, augmentedCtx
 }
 
+// limitBreadcrumbs drops the oldest breadcrumbs exceeding MaxBreadcrumbs, and
+// records the number of dropped breadcrumbs in the metadata of the report.
+func (n *Notifier) limitBreadcrumbs(data *jsonCtxData) {
+	if limit := n.cfg.MaxBreadcrumbs; limit > 0 && len(data.breadcrumbs) > limit {
+		data.droppedBreadcrumbs += len(data.breadcrumbs) - limit
+		data.breadcrumbs = data.breadcrumbs[:limit] // newest first
+	}
+	if data.droppedBreadcrumbs > 0 {
+		data.metadata = withMetadatum(data.metadata, "breadcrumbs", "dropped", data.droppedBreadcrumbs)
+	}
+}
+
 func (n *Notifier) sendErrorReport(r *JSONErrorReport) error {
+	if n.cfg.DryRunWriter != nil {
+		return writePayload(n.cfg.DryRunWriter, r)
+	}
 	b, err := json.Marshal(r)
 	if err != nil {
 		return fmt.Errorf("unable to marshal JSON: %w", err)
@@ -226,6 +326,30 @@ func (n *Notifier) sendErrorReport(r *JSONErrorReport) error {
 	return nil
 }
 
+// withVCSMetadata adds the given VCS metadata to the "app" tab of the given
+// metadata, without overwriting any values already in the tab.
+func withVCSMetadata(metadata map[string]map[string]interface{}, vcs map[string]interface{}) map[string]map[string]interface{} {
+	if vcs == nil {
+		return metadata
+	}
+	for k, v := range metadata["app"] {
+		vcs[k] = v
+	}
+	return withMetadataTab(metadata, "app", vcs)
+}
+
+// writePayload writes the given payload to w as indented JSON.
+func writePayload(w io.Writer, payload interface{}) error {
+	b, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal JSON: %w", err)
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("unable to write payload: %w", err)
+	}
+	return nil
+}
+
 func makeUnhandled(err error) bool {
 	for {
 		if berr, ok := err.(*Error); ok && berr.Unhandled {
@@ -240,9 +364,12 @@ func makeUnhandled(err error) bool {
 }
 
 func makeSeverity(err error) string {
+	if berr := extractSeverityReasonOverride(err); berr != nil && berr.Severity != severityUndetermined {
+		return berr.Severity.String()
+	}
 	if berr := extractLowestBugsnagError(err); berr != nil {
 		if s := berr.Severity; s != severityUndetermined {
-			return []string{"undetermined", "info", "warning", "error"}[s]
+			return s.String()
 		}
 		if berr.Unhandled || berr.Panic {
 			return "error"
@@ -256,6 +383,9 @@ func severityReasonType(err error) string {
 		prefix = "handled"
 		suffix = "Exception"
 	)
+	if berr := extractSeverityReasonOverride(err); berr != nil {
+		return berr.severityReason
+	}
 	if lowestBugsnagErr := extractLowestBugsnagError(err); lowestBugsnagErr != nil {
 		if lowestBugsnagErr.Severity != severityUndetermined {
 			return "userSpecifiedSeverity"
@@ -270,13 +400,15 @@ func severityReasonType(err error) string {
 	return prefix + suffix
 }
 
-func makeExceptions(err error) []*JSONException {
+// errorChain returns the given error followed by the errors it wraps, from
+// the outermost to the innermost error.
+func errorChain(err error) []error {
 	var errs []error
 	for {
 		if err == nil {
 			break
 		}
-		errs = append([]error{err}, errs...)
+		errs = append(errs, err)
 
 		switch e := err.(type) {
 		case causer:
@@ -290,15 +422,18 @@ func makeExceptions(err error) []*JSONException {
 			err = errors.Unwrap(err)
 		}
 	}
+	return errs
+}
 
+func makeExceptions(err error) []*JSONException {
+	errs := errorChain(err)
 	eps := make([]*JSONException, len(errs))
 	for i, err := range errs { //nolint:varnamelen // indexes are conventionally i
 		var stacktrace []*JSONStackframe
 		if berr, ok := err.(*Error); ok {
 			stacktrace = berr.stacktrace
 		}
-		// reverse the order to match the API
-		eps[len(errs)-i-1] = &JSONException{
+		eps[i] = &JSONException{
 			ErrorClass: reflect.TypeOf(err).String(),
 			Message:    err.Error(),
 			Stacktrace: stacktrace,
@@ -425,6 +560,18 @@ func extractLowestBugsnagError(err error) *Error {
 	return berr
 }
 
+// extractSeverityReasonOverride returns the lowest *Error in the chain that
+// has had its severity reason explicitly set with WithSeverityReason, if any.
+func extractSeverityReasonOverride(err error) *Error {
+	var berr *Error
+	for ; err != nil; err = errors.Unwrap(err) {
+		if b, ok := err.(*Error); ok && b.severityReason != "" {
+			berr = b
+		}
+	}
+	return berr
+}
+
 func (n *Notifier) guard(method string) {
 	if p := recover(); p != nil {
 		n.cfg.InternalErrorCallback(fmt.Errorf("panic when calling %s (did you invoke %s after calling Close?): %v", method, method, p))
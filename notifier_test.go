@@ -1,10 +1,13 @@
 package bugsnag
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -139,3 +142,105 @@ func TestInternalErrorCallback(t *testing.T) {
 		n.Notify(nil, nil)
 	})
 }
+
+func TestEnabledReleaseStages(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name         string
+		stages       []string
+		sanitize     bool
+		expReported  bool
+		expSanitized bool
+	}{
+		{name: "all stages enabled by default", stages: nil, expReported: true, expSanitized: true},
+		{name: "enabled stage", stages: []string{"dev", "prod"}, expReported: true, expSanitized: true},
+		{name: "disabled stage", stages: []string{"prod"}},
+		{name: "disabled stage with sanitizers", stages: []string{"prod"}, sanitize: true, expSanitized: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu                       sync.Mutex
+				errorsSanitized, started int
+				sessionsPublished        int
+			)
+			out := &bytes.Buffer{}
+			n, err := New(Configuration{
+				APIKey:                        "abcd1234abcd1234abcd1234abcd1234",
+				ReleaseStage:                  "dev",
+				AppVersion:                    "1.2.3",
+				EnabledReleaseStages:          tc.stages,
+				SanitizeDisabledReleaseStages: tc.sanitize,
+				DryRunWriter:                  out,
+				ErrorReportSanitizer: func(_ context.Context, _ *JSONErrorReport) error {
+					mu.Lock()
+					defer mu.Unlock()
+					errorsSanitized++
+					return nil
+				},
+				SessionStartSanitizer: func(_ context.Context, _ *SessionStart) error {
+					mu.Lock()
+					defer mu.Unlock()
+					started++
+					return nil
+				},
+				SessionReportSanitizer: func(_ *JSONSessionReport) error {
+					sessionsPublished++
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n.Notify(n.StartSession(context.Background()), errors.New("oops"))
+			n.Close()
+			written := strings.Count(out.String(), `"apiKey"`) + strings.Count(out.String(), `"sessionCounts"`)
+
+			expSanitized, expReported := 0, 0
+			if tc.expSanitized {
+				expSanitized = 1
+			}
+			if tc.expReported {
+				expReported = 1
+			}
+			if errorsSanitized != expSanitized || started != expSanitized {
+				t.Errorf("expected %d invocations of the sanitizers but got %d and %d", expSanitized, errorsSanitized, started)
+			}
+			if sessionsPublished != expReported || written != 2*expReported {
+				t.Errorf("expected reporting to be %v but got %d session reports and output:\n%s", tc.expReported, sessionsPublished, out)
+			}
+		})
+	}
+}
+
+func TestDryRunWriter(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	n, err := New(Configuration{
+		APIKey:           "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage:     "dev",
+		AppVersion:       "1.2.3",
+		EndpointNotify:   "http://localhost:0",
+		EndpointSessions: "http://localhost:0",
+		DryRunWriter:     out,
+		InternalErrorCallback: func(err error) {
+			t.Errorf("expected no internal errors as nothing should be sent but got %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(context.Background(), errors.New("oops"))
+	n.Close()
+
+	if !strings.Contains(out.String(), "\n  \"") {
+		t.Errorf("expected indented JSON but got\n%s", out)
+	}
+	var report JSONErrorReport
+	if err := json.NewDecoder(out).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Events[0].Exceptions[0].Message; got != "oops" {
+		t.Errorf("expected the error report to be written but got message '%s'", got)
+	}
+}
@@ -141,11 +141,18 @@ type JSONEvent struct {
 
 	Session *JSONSession `json:"session,omitempty"`
 
+	// Correlation identifies the trace and span that the event occurred in.
+	Correlation *JSONCorrelation `json:"correlation,omitempty"`
+
 	// An object containing any further data you wish to attach to this error
 	// event. The key of the outermost map indicates the tab under which to display this information in Bugsnag.
 	// The key of the innermost map indicates the property name, and the value is it's value
 	Metadata map[string]map[string]interface{} `json:"metaData,omitempty"`
 
+	// FeatureFlags lists the feature flags and experiments that were active
+	// at the time of the error.
+	FeatureFlags []*JSONFeatureFlag `json:"featureFlags,omitempty"`
+
 	// GroupingHash is a unique value that can be set in order to override the
 	// grouping on the Bugsnag dashboard.
 	//  **Warning: Do not set unless you're 100% sure of what you're doing.**
@@ -207,6 +214,26 @@ type JSONBreadcrumb struct {
 	Metadata map[string]interface{} `json:"metaData,omitempty"`
 }
 
+// JSONCorrelation identifies the distributed trace, and the span within it,
+// that an event occurred in.
+type JSONCorrelation struct {
+	// TraceID is the ID of the trace, as 32 hex characters.
+	TraceID string `json:"traceId"`
+
+	// SpanID is the ID of the span, as 16 hex characters.
+	SpanID string `json:"spanId,omitempty"`
+}
+
+// JSONFeatureFlag is a feature flag or experiment that was active at the time
+// of the error.
+type JSONFeatureFlag struct {
+	// FeatureFlag is the name of the feature flag.
+	FeatureFlag string `json:"featureFlag"`
+
+	// Variant is the variant of the feature flag in use, if any.
+	Variant string `json:"variant,omitempty"`
+}
+
 // JSONRequest contains details about the web request from the client that
 // experienced the error, if relevant. To display custom request data alongside
 // these standard fields on the Bugsnag website, the custom data should be
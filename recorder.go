@@ -0,0 +1,94 @@
+package bugsnag
+
+import (
+	"context"
+	"sync"
+)
+
+// breadcrumbRecorder is a goroutine-safe, mutable list of breadcrumbs shared
+// by all contexts derived from the context it was attached to.
+// If a max is set, breadcrumbs are kept in a ring buffer that drops the
+// oldest breadcrumb when full.
+type breadcrumbRecorder struct {
+	mu          sync.Mutex
+	breadcrumbs []Breadcrumb
+	max         int
+	start       int // index of the oldest breadcrumb once the buffer is full
+	dropped     int
+}
+
+// WithBreadcrumbRecorder attaches a breadcrumb recorder to the given context.
+// Any breadcrumbs subsequently added with WithBreadcrumb to this context, or
+// any context derived from it, are recorded in place in the recorder, rather
+// than in the context returned from WithBreadcrumb.
+// This means that breadcrumbs added deep in your call stack show up in error
+// reports even when the returned context is not passed back up to where Notify
+// is called, as is typically the case for breadcrumbs added in logging or
+// instrumentation libraries.
+// You should attach a recorder once per unit of work, e.g. per request in
+// your server middleware. Calling this method with a context that already has
+// a recorder attached returns the given context as-is.
+// The recorder is safe for concurrent use, so goroutines started as part of
+// this unit of work may add breadcrumbs to it too.
+func (n *Notifier) WithBreadcrumbRecorder(ctx context.Context) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	if getBreadcrumbRecorder(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, breadcrumbRecorderKey, &breadcrumbRecorder{max: n.cfg.MaxBreadcrumbs})
+}
+
+func (r *breadcrumbRecorder) record(breadcrumb Breadcrumb) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.max <= 0 || len(r.breadcrumbs) < r.max {
+		r.breadcrumbs = append(r.breadcrumbs, breadcrumb)
+		return
+	}
+	r.breadcrumbs[r.start] = breadcrumb
+	r.start = (r.start + 1) % r.max
+	r.dropped++
+}
+
+// snapshot returns a copy of the breadcrumbs recorded so far, oldest first,
+// along with the number of breadcrumbs that have been dropped.
+func (r *breadcrumbRecorder) snapshot() ([]Breadcrumb, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.breadcrumbs == nil {
+		return nil, r.dropped
+	}
+	bcs := make([]Breadcrumb, 0, len(r.breadcrumbs))
+	bcs = append(bcs, r.breadcrumbs[r.start:]...)
+	return append(bcs, r.breadcrumbs[:r.start]...), r.dropped
+}
+
+func getBreadcrumbRecorder(ctx context.Context) *breadcrumbRecorder {
+	if r, ok := ctx.Value(breadcrumbRecorderKey).(*breadcrumbRecorder); ok {
+		return r
+	}
+	return nil
+}
+
+// getBreadcrumbs returns the breadcrumbs attached to the given context,
+// followed by any breadcrumbs in its breadcrumb recorder, oldest first, along
+// with the total number of breadcrumbs that have been dropped.
+func getBreadcrumbs(ctx context.Context) ([]Breadcrumb, int) {
+	cd := getAttachedContextData(ctx)
+	r := getBreadcrumbRecorder(ctx)
+	if r == nil {
+		return cd.Breadcrumbs, cd.DroppedBreadcrumbs
+	}
+	recorded, dropped := r.snapshot()
+	if cd.Breadcrumbs == nil {
+		return recorded, cd.DroppedBreadcrumbs + dropped
+	}
+	bcs := make([]Breadcrumb, 0, len(cd.Breadcrumbs)+len(recorded))
+	return append(append(bcs, cd.Breadcrumbs...), recorded...), cd.DroppedBreadcrumbs + dropped
+}
@@ -0,0 +1,107 @@
+package bugsnag
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestBreadcrumbRecorder(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("breadcrumbs added to derived contexts are visible from the parent", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithBreadcrumb(context.Background(), Breadcrumb{Name: "before recorder"})
+		ctx = n.WithBreadcrumbRecorder(ctx)
+		if got := n.WithBreadcrumbRecorder(ctx); got != ctx {
+			t.Error("expected attaching a recorder twice to return the given context")
+		}
+
+		func(ctx context.Context) {
+			ctx = n.WithBugsnagContext(ctx, "deep down")
+			n.WithBreadcrumb(ctx, Breadcrumb{Name: "deep down"})
+		}(ctx)
+		n.WithBreadcrumb(ctx, Breadcrumb{Name: "discarded ctx"})
+
+		bcs, _ := makeBreadcrumbs(ctx)
+		if len(bcs) != 3 {
+			t.Fatalf("expected 3 breadcrumbs but got %d", len(bcs))
+		}
+		for i, exp := range []string{"discarded ctx", "deep down", "before recorder"} {
+			if got := bcs[i].Name; got != exp {
+				t.Errorf("expected breadcrumb %d to be '%s' but was '%s'", i, exp, got)
+			}
+		}
+	})
+
+	t.Run("recorded breadcrumbs are serialized", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithBreadcrumbRecorder(context.Background())
+		n.WithBreadcrumb(ctx, Breadcrumb{Name: "recorded"})
+
+		got := getAttachedContextData(n.Deserialize(context.Background(), n.Serialize(ctx))).Breadcrumbs
+		if len(got) != 1 || got[0].Name != "recorded" {
+			t.Errorf("expected the recorded breadcrumb to be serialized but got %+v", got)
+		}
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithBreadcrumbRecorder(context.Background())
+		const goroutines = 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n.WithBreadcrumb(ctx, Breadcrumb{Name: "concurrent"})
+				_, _ = makeBreadcrumbs(ctx)
+			}()
+		}
+		wg.Wait()
+
+		if got, _ := makeBreadcrumbs(ctx); len(got) != goroutines {
+			t.Errorf("expected %d breadcrumbs but got %d", goroutines, len(got))
+		}
+	})
+
+	t.Run("drops the oldest breadcrumbs when full", func(t *testing.T) {
+		t.Parallel()
+		n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test", MaxBreadcrumbs: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := n.WithBreadcrumb(context.Background(), Breadcrumb{Name: "0"})
+		ctx = n.WithMetadatum(ctx, "breadcrumbs", "source", "user")
+		ctx = n.WithBreadcrumbRecorder(ctx)
+		for _, name := range []string{"1", "2", "3", "4", "5"} {
+			n.WithBreadcrumb(ctx, Breadcrumb{Name: name})
+		}
+
+		report, _ := n.makeReport(ctx, Wrap(ctx, errors.New("oops")))
+		event := report.Events[0]
+		if len(event.Breadcrumbs) != 3 {
+			t.Fatalf("expected 3 breadcrumbs but got %d", len(event.Breadcrumbs))
+		}
+		for i, exp := range []string{"5", "4", "3"} {
+			if got := event.Breadcrumbs[i].Name; got != exp {
+				t.Errorf("expected breadcrumb %d to be '%s' but was '%s'", i, exp, got)
+			}
+		}
+		if got := event.Metadata["breadcrumbs"]["dropped"]; got != 3 {
+			t.Errorf("expected 3 dropped breadcrumbs in the metadata but got %v", got)
+		}
+		if got := event.Metadata["breadcrumbs"]["source"]; got != "user" {
+			t.Errorf("expected the existing breadcrumbs metadata to be kept but got %v", got)
+		}
+		if md := n.Metadata(ctx); len(md["breadcrumbs"]) != 1 {
+			t.Errorf("expected the metadata of the context to be left as-is but got %v", md)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package bugsnag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces the values of redacted keys.
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedKeys are the RedactedKeys used unless configured otherwise.
+//
+//nolint:gochecknoglobals // Treated as a constant.
+var defaultRedactedKeys = []string{"password", "authorization", "cookie", "token"}
+
+// redactor matches the keys whose values should be redacted from error
+// reports.
+type redactor []*regexp.Regexp
+
+// makeRedactor compiles the given RedactedKeys. Keys wrapped in slashes are
+// regular expressions, and any other keys match any key containing them,
+// ignoring case.
+func makeRedactor(keys []string) (redactor, error) {
+	r := make(redactor, 0, len(keys))
+	for _, key := range keys {
+		expr := "(?i)" + regexp.QuoteMeta(key)
+		if len(key) > 1 && strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/") {
+			expr = key[1 : len(key)-1]
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redacted key %q: %w", key, err)
+		}
+		r = append(r, re)
+	}
+	return r, nil
+}
+
+func (r redactor) matches(key string) bool {
+	for _, re := range r {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEvent redacts the metadata, breadcrumb metadata, request headers and
+// request URL query parameters of the given event.
+// The data of the event may be shared with the contexts it was extracted
+// from, so anything that is redacted is copied rather than modified in place.
+func (r redactor) redactEvent(event *JSONEvent) {
+	if len(r) == 0 || event == nil {
+		return
+	}
+	if event.Metadata != nil {
+		md := make(map[string]map[string]interface{}, len(event.Metadata))
+		for tab, kvs := range event.Metadata {
+			md[tab] = r.redactMap(kvs)
+		}
+		event.Metadata = md
+	}
+	for _, bc := range event.Breadcrumbs {
+		bc.Metadata = r.redactMap(bc.Metadata)
+	}
+	if event.Request != nil {
+		req := *event.Request
+		req.Headers = r.redactHeaders(req.Headers)
+		req.URL = r.redactURL(req.URL)
+		req.Referer = r.redactURL(req.Referer)
+		event.Request = &req
+	}
+}
+
+func (r redactor) redactMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if r.matches(k) {
+			redacted[k] = redactedValue
+			continue
+		}
+		redacted[k] = r.redactValue(v)
+	}
+	return redacted
+}
+
+// redactValue redacts the values of nested maps, slices and structs, as
+// commonly found in metadata. Maps with string keys and slices of types other
+// than those handled explicitly are redacted with reflection, returning a copy
+// of the same type. Structs are redacted by way of their JSON representation,
+// as that's what gets sent to Bugsnag.
+func (r redactor) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return r.redactMap(v)
+	case map[string]string:
+		return r.redactHeaders(v)
+	case http.Header:
+		return http.Header(r.redactMultiValues(v))
+	case map[string][]string:
+		return r.redactMultiValues(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, e := range v {
+			redacted[i] = r.redactValue(e)
+		}
+		return redacted
+	default:
+		return r.redactReflectValue(reflect.ValueOf(v))
+	}
+}
+
+func (r redactor) redactMultiValues(m map[string][]string) map[string][]string {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string][]string, len(m))
+	for k, v := range m {
+		if r.matches(k) {
+			v = []string{redactedValue}
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// redactReflectValue redacts maps with string keys, slices of any type, and
+// structs, returning any other value as-is. Maps and slices with elements
+// that can't be redacted in place, e.g. structs, are redacted by way of their
+// JSON representation, like structs.
+func (r redactor) redactReflectValue(rv reflect.Value) interface{} {
+	switch {
+	case !rv.IsValid():
+		return nil
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String && !rv.IsNil():
+		redacted := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			if r.matches(iter.Key().String()) {
+				redacted.SetMapIndex(iter.Key(), redactedReflectValue(rv.Type().Elem()))
+				continue
+			}
+			elem, ok := r.redactElem(iter.Value(), rv.Type().Elem())
+			if !ok {
+				return r.redactJSONValue(rv.Interface())
+			}
+			redacted.SetMapIndex(iter.Key(), elem)
+		}
+		return redacted.Interface()
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 && !rv.IsNil():
+		redacted := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elem, ok := r.redactElem(rv.Index(i), rv.Type().Elem())
+			if !ok {
+				return r.redactJSONValue(rv.Interface())
+			}
+			redacted.Index(i).Set(elem)
+		}
+		return redacted.Interface()
+	case rv.Kind() == reflect.Struct, rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct:
+		return r.redactJSONValue(rv.Interface())
+	default:
+		return rv.Interface()
+	}
+}
+
+// redactElem redacts the given element of a map or slice with the given
+// element type, reporting whether the redacted element is of that type.
+func (r redactor) redactElem(elem reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	redacted := reflect.ValueOf(r.redactValue(elem.Interface()))
+	if !redacted.IsValid() {
+		return reflect.Zero(typ), true
+	}
+	if !redacted.Type().ConvertibleTo(typ) {
+		return reflect.Value{}, false
+	}
+	return redacted.Convert(typ), true
+}
+
+// redactJSONValue redacts the JSON representation of the given value,
+// returning the value as-is if it can't be represented as JSON.
+func (r redactor) redactJSONValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as-is, rather than risking precision loss with float64.
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return v
+	}
+	return r.redactValue(decoded)
+}
+
+// redactedReflectValue returns the redacted value for the values of maps
+// with the given element type, falling back to the zero value for element
+// types that can't hold a string.
+func redactedReflectValue(typ reflect.Type) reflect.Value {
+	switch {
+	case typ.Kind() == reflect.String, typ.Kind() == reflect.Interface && reflect.TypeOf(redactedValue).Implements(typ):
+		return reflect.ValueOf(redactedValue).Convert(typ)
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.String:
+		redacted := reflect.MakeSlice(typ, 1, 1)
+		redacted.Index(0).Set(reflect.ValueOf(redactedValue).Convert(typ.Elem()))
+		return redacted
+	default:
+		return reflect.Zero(typ)
+	}
+}
+
+func (r redactor) redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if r.matches(k) {
+			v = redactedValue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// redactURL redacts the values of matching query parameters in the given
+// URL, leaving the rest of the URL, including the order of the query
+// parameters, as-is.
+func (r redactor) redactURL(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && r.matches(unescaped) {
+			params[i] = name + "=" + redactedValue
+		}
+	}
+	redacted := base + "?" + strings.Join(params, "&")
+	if hasFragment {
+		redacted += "#" + fragment
+	}
+	return redacted
+}
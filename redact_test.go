@@ -0,0 +1,155 @@
+package bugsnag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Attempts int64  `json:"attempts"`
+}
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+	makeEvent := func(t *testing.T, redactedKeys []string) (*JSONEvent, map[string]interface{}) {
+		t.Helper()
+		n, err := New(Configuration{
+			APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+			ReleaseStage: "dev",
+			AppVersion:   "1.2.3",
+			RedactedKeys: redactedKeys,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := map[string]interface{}{
+			"name":      "River",
+			"Password":  "hunter2",
+			"sessions":  []interface{}{map[string]interface{}{"id": 1, "refresh_token": "abc"}},
+			"X-Api-Key": "s3cr3t",
+			"headers":   http.Header{"Authorization": {"Bearer secret"}, "Accept": {"text/html"}},
+			"query":     map[string][]string{"access_token": {"abc"}},
+			"nested":    map[string]map[string]interface{}{"x": {"password": "hunter2", "id": 1}},
+			"typed":     map[string]int{"token": 42, "count": 1},
+			"login":     loginRequest{Username: "river", Password: "hunter2", Attempts: 1 << 60},
+			"logins":    map[string]*loginRequest{"first": {Username: "river", Password: "hunter2"}},
+		}
+		req := httptest.NewRequest(http.MethodGet, "/login?user=river&access_token=abc&page=2#top", http.NoBody)
+		req.Header.Set("X-Csrf-Token", "xyz")
+		req.Header.Set("Accept", "text/html")
+
+		ctx := n.WithRequest(context.Background(), req)
+		ctx = n.WithMetadata(ctx, "account", account)
+		ctx = n.WithBreadcrumb(ctx, Breadcrumb{Name: "login", Metadata: map[string]interface{}{"password": "hunter2"}})
+		report, _ := n.makeReport(ctx, errors.New("oops"))
+		return report.Events[0], account
+	}
+
+	t.Run("default keys", func(t *testing.T) {
+		t.Parallel()
+		event, account := makeEvent(t, nil)
+
+		expAccount := map[string]interface{}{
+			"name":      "River",
+			"Password":  "[REDACTED]",
+			"sessions":  []interface{}{map[string]interface{}{"id": 1, "refresh_token": "[REDACTED]"}},
+			"X-Api-Key": "s3cr3t",
+			"headers":   http.Header{"Authorization": {"[REDACTED]"}, "Accept": {"text/html"}},
+			"query":     map[string][]string{"access_token": {"[REDACTED]"}},
+			"nested":    map[string]map[string]interface{}{"x": {"password": "[REDACTED]", "id": 1}},
+			"typed":     map[string]int{"token": 0, "count": 1},
+			"login":     map[string]interface{}{"username": "river", "password": "[REDACTED]", "attempts": json.Number("1152921504606846976")},
+			"logins": map[string]interface{}{
+				"first": map[string]interface{}{"username": "river", "password": "[REDACTED]", "attempts": json.Number("0")},
+			},
+		}
+		if got := event.Metadata["account"]; !reflect.DeepEqual(got, expAccount) {
+			t.Errorf("expected metadata\n%v\nbut got\n%v", expAccount, got)
+		}
+		if got := event.Breadcrumbs[0].Metadata["password"]; got != "[REDACTED]" {
+			t.Errorf("expected breadcrumb metadata to be redacted but got '%v'", got)
+		}
+		if got := event.Request.Headers; got["X-Csrf-Token"] != "[REDACTED]" || got["Accept"] != "text/html" {
+			t.Errorf("expected only the token header to be redacted but got %v", got)
+		}
+		if got, exp := event.Request.URL, "http://example.com/login?user=river&access_token=[REDACTED]&page=2#top"; got != exp {
+			t.Errorf("expected URL '%s' but got '%s'", exp, got)
+		}
+		if account["Password"] != "hunter2" || account["headers"].(http.Header).Get("Authorization") != "Bearer secret" ||
+			account["nested"].(map[string]map[string]interface{})["x"]["password"] != "hunter2" ||
+			account["login"].(loginRequest).Password != "hunter2" || account["logins"].(map[string]*loginRequest)["first"].Password != "hunter2" {
+			t.Error("expected the metadata attached to the context to be left as-is")
+		}
+	})
+
+	t.Run("custom keys and regexes", func(t *testing.T) {
+		t.Parallel()
+		event, _ := makeEvent(t, []string{"/^X-.*-Key$/", "user"})
+		md := event.Metadata["account"]
+		if md["X-Api-Key"] != "[REDACTED]" || md["Password"] != "hunter2" {
+			t.Errorf("expected only the configured keys to be redacted but got %v", md)
+		}
+		if got, exp := event.Request.URL, "http://example.com/login?user=[REDACTED]&access_token=abc&page=2#top"; got != exp {
+			t.Errorf("expected URL '%s' but got '%s'", exp, got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		event, _ := makeEvent(t, []string{})
+		if got := event.Metadata["account"]["Password"]; got != "hunter2" {
+			t.Errorf("expected no redaction but got '%v'", got)
+		}
+	})
+
+	t.Run("data added by the sanitizer", func(t *testing.T) {
+		t.Parallel()
+		out := &bytes.Buffer{}
+		n, err := New(Configuration{
+			APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+			ReleaseStage: "dev",
+			AppVersion:   "1.2.3",
+			DryRunWriter: out,
+			ErrorReportSanitizer: func(_ context.Context, p *JSONErrorReport) error {
+				p.Events[0].Metadata = map[string]map[string]interface{}{
+					"otel": {"http.request.header.authorization": "Bearer secret"},
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Notify(context.Background(), errors.New("oops"))
+		n.Close()
+
+		var report JSONErrorReport
+		if err := json.NewDecoder(out).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if got := report.Events[0].Metadata["otel"]["http.request.header.authorization"]; got != "[REDACTED]" {
+			t.Errorf("expected metadata added by the sanitizer to be redacted but got '%v'", got)
+		}
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		t.Parallel()
+		_, err := New(Configuration{
+			APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+			ReleaseStage: "dev",
+			AppVersion:   "1.2.3",
+			RedactedKeys: []string{"/[/"},
+		})
+		if err == nil {
+			t.Error("expected an error for an invalid regex but got none")
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package bugsnag
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// sensitiveHeaders lists the (canonicalized) request headers that are never
+// attached to error reports, as they are likely to contain credentials.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// WithRequest attaches details about the given incoming HTTP request to the
+// given context, such that they show up in the "Request" tab in the Bugsnag
+// dashboard for errors reported with this context.
+// The HTTP method, URL, referer, and headers are recorded, as well as the IP
+// of the client. The client IP is read from the first of the
+// Configuration.TrustedProxyHeaders headers present in the request, falling
+// back to the remote address of the request.
+// Headers that are likely to contain credentials, such as Authorization and
+// Cookie, are not recorded.
+// This data is not propagated to other services via Serialize.
+func (n *Notifier) WithRequest(ctx context.Context, req *http.Request) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	if req == nil {
+		return ctx
+	}
+	request := &JSONRequest{
+		ClientIP:   n.clientIP(req),
+		Headers:    makeRequestHeaders(req.Header),
+		HTTPMethod: req.Method,
+		URL:        makeRequestURL(req),
+		Referer:    req.Referer(),
+	}
+	return withContextData(ctx, func(cd *ctxData) { cd.Request = request })
+}
+
+func (n *Notifier) clientIP(req *http.Request) string {
+	for _, header := range n.cfg.TrustedProxyHeaders {
+		if ip := forwardedClientIP(req.Header.Values(header)); ip != "" {
+			return ip
+		}
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// forwardedClientIP returns the client IP from the given values of a header
+// such as X-Forwarded-For, which proxies append to as a comma separated list.
+// As clients may send any value of their own, the leftmost entries can't be
+// trusted. Instead, the rightmost entry that isn't a private or loopback
+// address, i.e. the address of the first proxy outside of your network, is
+// returned, falling back to the rightmost entry if all entries are private.
+func forwardedClientIP(values []string) string {
+	entries := strings.Split(strings.Join(values, ","), ",")
+	rightmost := ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if entry == "" {
+			continue
+		}
+		if rightmost == "" {
+			rightmost = entry
+		}
+		if ip := net.ParseIP(entry); ip == nil || !(ip.IsPrivate() || ip.IsLoopback()) {
+			return entry
+		}
+	}
+	return rightmost
+}
+
+func makeRequestHeaders(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func makeRequestURL(req *http.Request) string {
+	if req.URL == nil {
+		return ""
+	}
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	// Incoming server requests only populate the path and query of the URL.
+	u := *req.URL
+	u.Scheme = "http"
+	if req.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = req.Host
+	return u.String()
+}
@@ -0,0 +1,123 @@
+package bugsnag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kinbiko/jsonassert"
+)
+
+func TestWithRequest(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name                string
+		trustedProxyHeaders []string
+		forwardedFor        string
+		exp                 string
+	}{
+		{
+			name: "no trusted proxy headers",
+			exp: `{
+				"clientIp": "192.0.2.1",
+				"headers": { "Referer": "https://example.com/pokedex", "X-Forwarded-For": "203.0.113.7, 10.0.0.1" },
+				"httpMethod": "POST",
+				"url": "http://example.com/pokemon?type=fire",
+				"referer": "https://example.com/pokedex"
+			}`,
+		},
+		{
+			name:                "trusted proxy header",
+			trustedProxyHeaders: []string{"X-Real-Ip", "X-Forwarded-For"},
+			exp: `{
+				"clientIp": "203.0.113.7",
+				"headers": { "Referer": "https://example.com/pokedex", "X-Forwarded-For": "203.0.113.7, 10.0.0.1" },
+				"httpMethod": "POST",
+				"url": "http://example.com/pokemon?type=fire",
+				"referer": "https://example.com/pokedex"
+			}`,
+		},
+		{
+			name:                "spoofed proxy header",
+			trustedProxyHeaders: []string{"X-Forwarded-For"},
+			forwardedFor:        "6.6.6.6, 203.0.113.7, 10.0.0.1",
+			exp: `{
+				"clientIp": "203.0.113.7",
+				"headers": { "Referer": "https://example.com/pokedex", "X-Forwarded-For": "6.6.6.6, 203.0.113.7, 10.0.0.1" },
+				"httpMethod": "POST",
+				"url": "http://example.com/pokemon?type=fire",
+				"referer": "https://example.com/pokedex"
+			}`,
+		},
+		{
+			name:                "private addresses only",
+			trustedProxyHeaders: []string{"X-Forwarded-For"},
+			forwardedFor:        "10.9.9.9, 10.0.0.5",
+			exp: `{
+				"clientIp": "10.0.0.5",
+				"headers": { "Referer": "https://example.com/pokedex", "X-Forwarded-For": "10.9.9.9, 10.0.0.5" },
+				"httpMethod": "POST",
+				"url": "http://example.com/pokemon?type=fire",
+				"referer": "https://example.com/pokedex"
+			}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			n, err := New(Configuration{
+				APIKey:              "abcd1234abcd1234abcd1234abcd1234",
+				ReleaseStage:        "dev",
+				AppVersion:          "1.2.3",
+				TrustedProxyHeaders: tc.trustedProxyHeaders,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", "/pokemon?type=fire", nil)
+			req.Header.Set("Referer", "https://example.com/pokedex")
+			forwardedFor := "203.0.113.7, 10.0.0.1"
+			if tc.forwardedFor != "" {
+				forwardedFor = tc.forwardedFor
+			}
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Cookie", "session=secret")
+
+			ctx := n.WithRequest(context.Background(), req)
+			report, _ := n.makeReport(ctx, errors.New("oops"))
+			payload, _ := json.Marshal(report.Events[0].Request)
+			jsonassert.New(t).Assertf(string(payload), tc.exp)
+		})
+	}
+
+	t.Run("request from the deepest wrapped ctx takes precedence", func(t *testing.T) {
+		t.Parallel()
+		n, err := New(Configuration{APIKey: "abcd1234abcd1234abcd1234abcd1234", ReleaseStage: "dev", AppVersion: "1.2.3"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := n.WithRequest(context.Background(), httptest.NewRequest("GET", "/outer", nil))
+		innerCtx := n.WithRequest(context.Background(), httptest.NewRequest("GET", "/inner", nil))
+
+		report, _ := n.makeReport(ctx, Wrap(innerCtx, errors.New("oops")))
+		if got, exp := report.Events[0].Request.URL, "http://example.com/inner"; got != exp {
+			t.Errorf("expected request URL '%s' but got '%s'", exp, got)
+		}
+	})
+
+	t.Run("is not serialized", func(t *testing.T) {
+		t.Parallel()
+		n, err := New(Configuration{APIKey: "abcd1234abcd1234abcd1234abcd1234", ReleaseStage: "dev", AppVersion: "1.2.3"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := n.WithRequest(context.Background(), httptest.NewRequest("GET", "/", nil))
+		ctx = n.Deserialize(context.Background(), n.Serialize(ctx))
+		if got := getAttachedContextData(ctx).Request; got != nil {
+			t.Errorf("expected no request data after deserializing but got %+v", got)
+		}
+	})
+}
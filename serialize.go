@@ -0,0 +1,371 @@
+package bugsnag
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The serialization format of the current version is made up of the
+// following dot-separated fields, which are all URL and header safe:
+//
+//	v1.<codec>.<payload>
+//
+// where <codec> describes how the URL-safe, unpadded, base64 encoded
+// <payload> is encoded:
+//
+//   - "j": JSON encoded context data,
+//   - "z": DEFLATE compressed, JSON encoded, context data.
+//
+// If signing keys are configured, a fourth field holds the URL-safe,
+// unpadded, base64 encoded HMAC-SHA256 of the preceding fields, including
+// the separating dot:
+//
+//	v1.<codec>.<payload>.<signature>
+//
+// Data without a version prefix is assumed to be in the legacy format: the
+// standard base64 encoding of the JSON encoded context data.
+const (
+	serializationVersion = "v1"
+
+	codecJSON     = "j"
+	codecCompress = "z"
+
+	// maxDecompressedBytes protects against maliciously crafted data that
+	// decompresses to vast amounts of memory.
+	maxDecompressedBytes = 1 << 20
+)
+
+// Serialize extracts all the diagnostic data tracked within the given ctx to a
+// []byte that can later be deserialized using Deserialize. Useful for passing
+// diagnostic to downstream services in header values.
+// The output is versioned, such that future changes to the format don't break
+// propagation between services on different versions of this package, and is
+// safe to use in URLs and HTTP headers. Note that versions of this package
+// preceding the versioned format are unable to deserialize the output.
+// Set Configuration.LegacySerializationFormat to keep producing the legacy
+// format until all consuming services have been upgraded.
+// If Configuration.CompressSerializedData is set the data is compressed, and
+// if the output exceeds Configuration.MaxSerializedBytes, the oldest
+// breadcrumbs are dropped until it fits. If the data doesn't fit even
+// without breadcrumbs, the metadata and feature flags are dropped too, and
+// then the user. The Bugsnag context and the session are always included,
+// even if this means exceeding the limit, in which case the
+// InternalErrorCallback is invoked.
+// If Configuration.PropagationSigningKeys is set the output is signed with
+// the first key.
+// Any active session attached to the ctx, or else the session of the process
+// if Configuration.SessionPerProcess is set, is included, such that errors
+// reported by downstream services count towards this session.
+func (n *Notifier) Serialize(ctx context.Context) []byte {
+	cd := n.propagated(getAttachedContextData(ctx))
+	cd.Breadcrumbs, cd.DroppedBreadcrumbs = getBreadcrumbs(ctx)
+	if sess := n.sessionOf(ctx); sess != nil && sess.state.Load() == sessionActive {
+		cd.Session = &propagatedSession{ID: sess.ID, StartedAt: sess.StartedAt}
+	}
+	b, err := n.serialize(cd)
+	if err != nil {
+		n.cfg.InternalErrorCallback(err)
+		return nil
+	}
+	limit := n.cfg.MaxSerializedBytes
+	if limit <= 0 || len(b) <= limit {
+		return b
+	}
+	b, err = n.serializeWithin(cd, limit)
+	if err != nil {
+		n.cfg.InternalErrorCallback(err)
+		return nil
+	}
+	return b
+}
+
+// serializeWithin serializes the given context data, which exceeds the given
+// limit, dropping data until it fits, as documented on Serialize.
+func (n *Notifier) serializeWithin(cd *ctxData, limit int) ([]byte, error) {
+	// Binary search for the largest number of breadcrumbs that fit, keeping
+	// the newest ones.
+	breadcrumbs, dropped := cd.Breadcrumbs, cd.DroppedBreadcrumbs
+	var fits []byte
+	for low, high := 0, len(breadcrumbs)-1; low <= high; {
+		keep := (low + high) / 2
+		cd.Breadcrumbs = breadcrumbs[len(breadcrumbs)-keep:]
+		cd.DroppedBreadcrumbs = dropped + len(breadcrumbs) - keep
+		b, err := n.serialize(cd)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) <= limit {
+			fits, low = b, keep+1
+		} else {
+			high = keep - 1
+		}
+	}
+	if fits != nil {
+		return fits, nil
+	}
+
+	cd.Breadcrumbs, cd.DroppedBreadcrumbs = nil, dropped+len(breadcrumbs)
+	for _, drop := range []func(){
+		func() { cd.Metadata, cd.FeatureFlags = nil, nil },
+		func() { cd.User = nil },
+	} {
+		drop()
+		b, err := n.serialize(cd)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) <= limit {
+			return b, nil
+		}
+	}
+	n.cfg.InternalErrorCallback(fmt.Errorf("unable to serialize diagnostic data within the limit of %d bytes, exceeding the limit", limit))
+	return n.serialize(cd)
+}
+
+func (n *Notifier) serialize(cd *ctxData) ([]byte, error) {
+	payload, err := json.Marshal(cd)
+	if err != nil {
+		return nil, err
+	}
+	if n.cfg.LegacySerializationFormat {
+		return []byte(base64.StdEncoding.EncodeToString(payload)), nil
+	}
+	codec := codecJSON
+	if n.cfg.CompressSerializedData {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression) // only errors on invalid levels
+		if _, err := w.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		codec, payload = codecCompress, buf.Bytes()
+	}
+	data := serializationVersion + "." + codec + "." + base64.RawURLEncoding.EncodeToString(payload)
+	if keys := n.cfg.PropagationSigningKeys; len(keys) > 0 {
+		data += "." + base64.RawURLEncoding.EncodeToString(sign(keys[0], data))
+	}
+	return []byte(data), nil
+}
+
+func sign(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// verify returns the given data without its signature, if the signature was
+// made with any of the configured signing keys. Data is returned as-is if no
+// signing keys are configured.
+func (n *Notifier) verify(data string) (string, error) {
+	keys := n.cfg.PropagationSigningKeys
+	if len(keys) == 0 {
+		if fields := strings.Split(data, "."); len(fields) == 4 {
+			return strings.Join(fields[:3], "."), nil
+		}
+		return data, nil
+	}
+	i := strings.LastIndex(data, ".")
+	if !strings.HasPrefix(data, "v") || i < 0 || strings.Count(data, ".") != 3 {
+		return "", errors.New("rejected unsigned diagnostic data")
+	}
+	unsigned := data[:i]
+	signature, err := base64.RawURLEncoding.DecodeString(data[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("rejected diagnostic data with a malformed signature: %w", err)
+	}
+	for _, key := range keys {
+		if hmac.Equal(signature, sign(key, unsigned)) {
+			return unsigned, nil
+		}
+	}
+	return "", errors.New("rejected diagnostic data with an invalid signature")
+}
+
+// DeserializeOption configures how Deserialize attaches the deserialized
+// diagnostic data to the context.
+type DeserializeOption func(*deserializeOptions)
+
+type deserializeOptions struct {
+	merge bool
+}
+
+// WithMerge returns a DeserializeOption that merges the deserialized
+// diagnostic data with the diagnostic data already attached to the context,
+// rather than replacing it:
+//
+//   - breadcrumbs are combined, ordered by their timestamps, dropping the
+//     oldest breadcrumbs exceeding Configuration.MaxBreadcrumbs,
+//   - metadata and feature flags are combined, with the existing data taking
+//     precedence over deserialized data with the same tab and key, or name,
+//   - the existing Bugsnag context and user take precedence, if set.
+func WithMerge() DeserializeOption {
+	return func(o *deserializeOptions) { o.merge = true }
+}
+
+// Deserialize extracts diagnostic data that has previously been serialized
+// with Serialize and attaches it to the given ctx. Intended to be called in
+// server middleware to attach diagnostic data identified from upstream
+// services. As a result, any existing diagnostic data (session data from
+// StartSession not inclusive) will be wiped, unless the WithMerge option is
+// given.
+// If the data includes the session of the upstream service, and the given ctx
+// has no session attached, this session is attached to the returned context,
+// such that errors reported with it count towards the upstream session, rather
+// than a session of this service. This session isn't counted as a new session.
+// Use ResumeSession to continue the upstream session if present, or start a
+// new session otherwise.
+// Data serialized by older versions of this package is supported.
+// Note: If the upstream service attaches sensitive data this service should
+// not report (e.g. user info), then this too will be propagated in this
+// context, unless excluded with Configuration.PropagatedMetadataTabs, or you
+// use the ErrorReportSanitizer to remove this data.
+// Configure Configuration.PropagationSigningKeys to reject data that wasn't
+// serialized by your own services, e.g. data sent by external clients.
+func (n *Notifier) Deserialize(ctx context.Context, data []byte, opts ...DeserializeOption) context.Context {
+	o := &deserializeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	unsigned, err := n.verify(string(data))
+	if err != nil {
+		n.cfg.InternalErrorCallback(err)
+		return ctx
+	}
+	cd, err := deserialize(unsigned)
+	if err != nil {
+		n.cfg.InternalErrorCallback(err)
+		return ctx
+	}
+	upstreamSession := cd.Session
+	cd.Session = nil
+	cd = n.propagated(cd)
+	if o.merge {
+		cd = n.merge(getAttachedContextData(ctx), cd)
+	}
+	ctx = context.WithValue(ctx, ctxDataKey, cd)
+	if upstreamSession != nil && getSession(ctx) == nil {
+		ctx = context.WithValue(ctx, sessionKey, &session{ID: upstreamSession.ID, StartedAt: upstreamSession.StartedAt})
+	}
+	return ctx
+}
+
+// propagated returns a copy of the given context data, without the data that
+// shouldn't cross service boundaries according to the configuration.
+func (n *Notifier) propagated(cd *ctxData) *ctxData {
+	propagated := *cd
+	if n.cfg.PropagatedMetadataTabs != nil {
+		propagated.User = nil
+	}
+	if tabs := n.cfg.PropagatedMetadataTabs; tabs != nil && cd.Metadata != nil {
+		propagated.Metadata = map[string]map[string]interface{}{}
+		for _, tab := range tabs {
+			if kvs, ok := cd.Metadata[tab]; ok {
+				propagated.Metadata[tab] = kvs
+			}
+		}
+	}
+	return &propagated
+}
+
+// merge returns the combination of the given local and upstream context
+// data, as documented on WithMerge.
+func (n *Notifier) merge(local, upstream *ctxData) *ctxData {
+	merged := *local
+	if merged.BContext == "" {
+		merged.BContext = upstream.BContext
+	}
+	if merged.User == nil {
+		merged.User = upstream.User
+	}
+
+	merged.Breadcrumbs = make([]Breadcrumb, 0, len(upstream.Breadcrumbs)+len(local.Breadcrumbs))
+	merged.Breadcrumbs = append(append(merged.Breadcrumbs, upstream.Breadcrumbs...), local.Breadcrumbs...)
+	sort.SliceStable(merged.Breadcrumbs, func(i, j int) bool {
+		return merged.Breadcrumbs[i].Timestamp.Before(merged.Breadcrumbs[j].Timestamp)
+	})
+	merged.DroppedBreadcrumbs = local.DroppedBreadcrumbs + upstream.DroppedBreadcrumbs
+	if limit := n.cfg.MaxBreadcrumbs; limit > 0 && len(merged.Breadcrumbs) > limit {
+		merged.DroppedBreadcrumbs += len(merged.Breadcrumbs) - limit
+		merged.Breadcrumbs = merged.Breadcrumbs[len(merged.Breadcrumbs)-limit:]
+	}
+
+	for tab, kvs := range upstream.Metadata {
+		tabKVs := make(map[string]interface{}, len(kvs)+len(local.Metadata[tab]))
+		for k, v := range kvs {
+			tabKVs[k] = v
+		}
+		for k, v := range local.Metadata[tab] {
+			tabKVs[k] = v
+		}
+		merged.Metadata = withMetadataTab(merged.Metadata, tab, tabKVs)
+	}
+
+	if upstream.FeatureFlags != nil {
+		merged.FeatureFlags = make(map[string]string, len(upstream.FeatureFlags)+len(local.FeatureFlags))
+		for name, variant := range upstream.FeatureFlags {
+			merged.FeatureFlags[name] = variant
+		}
+		for name, variant := range local.FeatureFlags {
+			merged.FeatureFlags[name] = variant
+		}
+	}
+	return &merged
+}
+
+func deserialize(data string) (*ctxData, error) {
+	payload, err := decodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+	cd := &ctxData{}
+	if err := json.Unmarshal(payload, cd); err != nil {
+		return nil, err
+	}
+	return cd, nil
+}
+
+// decodePayload returns the JSON encoded context data of the given serialized
+// data.
+func decodePayload(data string) ([]byte, error) {
+	if !strings.HasPrefix(data, "v") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	fields := strings.Split(data, ".")
+	if fields[0] != serializationVersion {
+		return nil, fmt.Errorf(`unsupported serialization version "%s"`, fields[0])
+	}
+	if len(fields) != 3 {
+		return nil, errors.New("malformed serialized data")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	switch fields[1] {
+	case codecJSON:
+		return payload, nil
+	case codecCompress:
+		decompressed, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(payload)), maxDecompressedBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > maxDecompressedBytes {
+			return nil, fmt.Errorf("decompressed data exceeds the limit of %d bytes", maxDecompressedBytes)
+		}
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf(`unsupported serialization codec "%s"`, fields[1])
+	}
+}
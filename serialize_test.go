@@ -0,0 +1,401 @@
+package bugsnag
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSerialize(t *testing.T) {
+	t.Parallel()
+	makeNotifier := func(t *testing.T, cfg Configuration) (*Notifier, func() []error) {
+		t.Helper()
+		var (
+			mu   sync.Mutex
+			errs []error
+		)
+		cfg.APIKey, cfg.AppVersion, cfg.ReleaseStage = "1234abcd1234abcd1234abcd1234abcd", "1.2.3", "test"
+		cfg.InternalErrorCallback = func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}
+		n, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n, func() []error {
+			mu.Lock()
+			defer mu.Unlock()
+			return errs
+		}
+	}
+	makeCtx := func(n *Notifier, breadcrumbs int) context.Context {
+		ctx := n.WithBugsnagContext(context.Background(), "/pokemon?type=fire")
+		ctx = n.WithUser(ctx, User{ID: "qwpeoiub"})
+		for i := 0; i < breadcrumbs; i++ {
+			ctx = n.WithBreadcrumb(ctx, Breadcrumb{Name: fmt.Sprintf("breadcrumb %d", i), Metadata: map[string]interface{}{"i": i}})
+		}
+		return ctx
+	}
+
+	for _, tc := range []struct {
+		name      string
+		compress  bool
+		expPrefix string
+	}{
+		{name: "uncompressed", expPrefix: "v1.j."},
+		{name: "compressed", compress: true, expPrefix: "v1.z."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			n, errs := makeNotifier(t, Configuration{CompressSerializedData: tc.compress})
+			data := n.Serialize(makeCtx(n, 3))
+			if !strings.HasPrefix(string(data), tc.expPrefix) {
+				t.Errorf("expected serialized data to start with '%s' but got '%s'", tc.expPrefix, data)
+			}
+			if strings.ContainsAny(string(data), "+/= ") {
+				t.Errorf("expected serialized data to be URL-safe but got '%s'", data)
+			}
+			cd := getAttachedContextData(n.Deserialize(context.Background(), data))
+			if cd.BContext != "/pokemon?type=fire" || cd.User.ID != "qwpeoiub" || len(cd.Breadcrumbs) != 3 {
+				t.Errorf("expected the context data to survive a round trip but got %+v", cd)
+			}
+			if got := errs(); len(got) != 0 {
+				t.Errorf("expected no errors but got %v", got)
+			}
+		})
+	}
+
+	t.Run("compression shrinks repetitive data", func(t *testing.T) {
+		t.Parallel()
+		n, _ := makeNotifier(t, Configuration{MaxSerializedBytes: -1})
+		c, _ := makeNotifier(t, Configuration{MaxSerializedBytes: -1, CompressSerializedData: true})
+		if uncompressed, compressed := len(n.Serialize(makeCtx(n, 50))), len(c.Serialize(makeCtx(c, 50))); compressed >= uncompressed {
+			t.Errorf("expected compressed data (%d bytes) to be smaller than uncompressed data (%d bytes)", compressed, uncompressed)
+		}
+	})
+
+	t.Run("drops the oldest breadcrumbs to fit the limit", func(t *testing.T) {
+		t.Parallel()
+		n, errs := makeNotifier(t, Configuration{MaxSerializedBytes: 512})
+		data := n.Serialize(makeCtx(n, 20))
+		if len(data) > 512 {
+			t.Errorf("expected at most 512 bytes but got %d", len(data))
+		}
+		cd := getAttachedContextData(n.Deserialize(context.Background(), data))
+		kept := len(cd.Breadcrumbs)
+		if kept == 0 || kept == 20 {
+			t.Fatalf("expected some but not all breadcrumbs to be kept but got %d", kept)
+		}
+		if got := cd.Breadcrumbs[kept-1].Name; got != "breadcrumb 19" {
+			t.Errorf("expected the newest breadcrumb to be kept but got '%s'", got)
+		}
+		if cd.DroppedBreadcrumbs != 20-kept {
+			t.Errorf("expected %d dropped breadcrumbs but got %d", 20-kept, cd.DroppedBreadcrumbs)
+		}
+		if got := errs(); len(got) != 0 {
+			t.Errorf("expected no errors but got %v", got)
+		}
+	})
+
+	t.Run("drops the metadata when no breadcrumbs fit the limit", func(t *testing.T) {
+		t.Parallel()
+		n, errs := makeNotifier(t, Configuration{MaxSerializedBytes: 128})
+		ctx := n.WithMetadatum(makeCtx(n, 1), "app", "notes", strings.Repeat("x", 200))
+		data := n.Serialize(ctx)
+		if len(data) == 0 || len(data) > 128 {
+			t.Fatalf("expected between 1 and 128 bytes but got %d", len(data))
+		}
+		cd := getAttachedContextData(n.Deserialize(context.Background(), data))
+		if cd.BContext != "/pokemon?type=fire" || cd.User.ID != "qwpeoiub" {
+			t.Errorf("expected the context and user to be kept but got %+v", cd)
+		}
+		if cd.Metadata != nil || len(cd.Breadcrumbs) != 0 || cd.DroppedBreadcrumbs != 1 {
+			t.Errorf("expected the metadata and breadcrumbs to be dropped but got %+v", cd)
+		}
+		if got := errs(); len(got) != 0 {
+			t.Errorf("expected no errors but got %v", got)
+		}
+	})
+
+	t.Run("unable to fit the limit", func(t *testing.T) {
+		t.Parallel()
+		n, errs := makeNotifier(t, Configuration{MaxSerializedBytes: 10})
+		cd := getAttachedContextData(n.Deserialize(context.Background(), n.Serialize(makeCtx(n, 1))))
+		if cd.BContext != "/pokemon?type=fire" || cd.User != nil || len(cd.Breadcrumbs) != 0 {
+			t.Errorf("expected only the context to be kept but got %+v", cd)
+		}
+		if got := errs(); len(got) != 1 {
+			t.Errorf("expected 1 error but got %v", got)
+		}
+	})
+
+	t.Run("legacy format", func(t *testing.T) {
+		t.Parallel()
+		n, errs := makeNotifier(t, Configuration{})
+		legacy := base64.StdEncoding.EncodeToString([]byte(`{"cx":"legacy","bc":null,"us":{"id":"123"},"md":{"app":{"nick":"charmander"}}}`))
+		cd := getAttachedContextData(n.Deserialize(context.Background(), []byte(legacy)))
+		if cd.BContext != "legacy" || cd.User.ID != "123" || cd.Metadata["app"]["nick"] != "charmander" {
+			t.Errorf("expected the legacy format to be deserialized but got %+v", cd)
+		}
+		if got := errs(); len(got) != 0 {
+			t.Errorf("expected no errors but got %v", got)
+		}
+	})
+
+	t.Run("legacy output", func(t *testing.T) {
+		t.Parallel()
+		n, errs := makeNotifier(t, Configuration{LegacySerializationFormat: true, CompressSerializedData: true})
+		data := n.Serialize(makeCtx(n, 1))
+		b, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil || !strings.HasPrefix(string(b), "{") {
+			t.Fatalf("expected base64 encoded JSON but got '%s'", data)
+		}
+		if cd := getAttachedContextData(n.Deserialize(context.Background(), data)); cd.BContext != "/pokemon?type=fire" {
+			t.Errorf("expected the context data to survive a round trip but got %+v", cd)
+		}
+		if got := errs(); len(got) != 0 {
+			t.Errorf("expected no errors but got %v", got)
+		}
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		t.Parallel()
+		for _, data := range []string{
+			"v2.j.e30",
+			"v1.j",
+			"v1.x.e30",
+			"v1.j.not base64",
+			"v1.z.e30",
+			"v1.j." + base64.RawURLEncoding.EncodeToString([]byte("not json")),
+			"not base64",
+		} {
+			n, errs := makeNotifier(t, Configuration{})
+			ctx := n.WithBugsnagContext(context.Background(), "local")
+			if got := getAttachedContextData(n.Deserialize(ctx, []byte(data))).BContext; got != "local" {
+				t.Errorf("expected the context to be unchanged for '%s' but got '%s'", data, got)
+			}
+			if got := errs(); len(got) != 1 {
+				t.Errorf("expected 1 error for '%s' but got %v", data, got)
+			}
+		}
+	})
+}
+
+func TestDeserializeWithMerge(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test", MaxBreadcrumbs: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	upstream := n.WithBugsnagContext(context.Background(), "upstream")
+	upstream = n.WithUser(upstream, User{ID: "upstream"})
+	upstream = n.WithBreadcrumb(upstream, Breadcrumb{Name: "upstream 1", Timestamp: at(1)})
+	upstream = n.WithBreadcrumb(upstream, Breadcrumb{Name: "upstream 3", Timestamp: at(3)})
+	upstream = n.WithMetadata(upstream, "app", map[string]interface{}{"nick": "upstream", "types": "fire"})
+	upstream = n.WithMetadatum(upstream, "upstream", "key", "value")
+	upstream = n.WithFeatureFlag(upstream, "shared", "upstream")
+	upstream = n.WithFeatureFlag(upstream, "upstream", "on")
+
+	local := n.WithBreadcrumb(context.Background(), Breadcrumb{Name: "local 0", Timestamp: at(0)})
+	local = n.WithBreadcrumb(local, Breadcrumb{Name: "local 2", Timestamp: at(2)})
+	local = n.WithMetadatum(local, "app", "nick", "local")
+	local = n.WithFeatureFlag(local, "shared", "local")
+
+	t.Run("merges the diagnostic data", func(t *testing.T) {
+		t.Parallel()
+		cd := getAttachedContextData(n.Deserialize(local, n.Serialize(upstream), WithMerge()))
+		if cd.BContext != "upstream" || cd.User == nil || cd.User.ID != "upstream" {
+			t.Errorf("expected the upstream context and user to be used when unset locally but got %+v", cd)
+		}
+		names := []string{}
+		for _, bc := range cd.Breadcrumbs {
+			names = append(names, bc.Name)
+		}
+		if got, exp := strings.Join(names, ","), "upstream 1,local 2,upstream 3"; got != exp {
+			t.Errorf("expected breadcrumbs '%s' but got '%s'", exp, got)
+		}
+		if cd.DroppedBreadcrumbs != 1 {
+			t.Errorf("expected 1 dropped breadcrumb but got %d", cd.DroppedBreadcrumbs)
+		}
+		if got := cd.Metadata["app"]; got["nick"] != "local" || got["types"] != "fire" {
+			t.Errorf("expected the app tab to be merged, preferring local data, but got %v", got)
+		}
+		if got := cd.Metadata["upstream"]["key"]; got != "value" {
+			t.Errorf("expected upstream tabs to be merged but got %v", got)
+		}
+		if got := cd.FeatureFlags; got["shared"] != "local" || got["upstream"] != "on" {
+			t.Errorf("expected feature flags to be merged, preferring local flags, but got %v", got)
+		}
+		if got := n.Metadata(local)["app"]; len(got) != 1 {
+			t.Errorf("expected the local context to be unchanged but got %v", got)
+		}
+	})
+
+	t.Run("local context and user take precedence", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.WithBugsnagContext(local, "local")
+		ctx = n.WithUser(ctx, User{ID: "local"})
+		cd := getAttachedContextData(n.Deserialize(ctx, n.Serialize(upstream), WithMerge()))
+		if cd.BContext != "local" || cd.User.ID != "local" {
+			t.Errorf("expected the local context and user to be kept but got %+v", cd)
+		}
+	})
+
+	t.Run("replaces the diagnostic data without merge", func(t *testing.T) {
+		t.Parallel()
+		cd := getAttachedContextData(n.Deserialize(local, n.Serialize(upstream)))
+		if len(cd.Breadcrumbs) != 2 || cd.Metadata["app"]["nick"] != "upstream" || cd.FeatureFlags["shared"] != "upstream" {
+			t.Errorf("expected only the upstream data but got %+v", cd)
+		}
+	})
+}
+
+func TestSelectivePropagation(t *testing.T) {
+	t.Parallel()
+	makeCtx := func(n *Notifier) context.Context {
+		ctx := n.WithUser(context.Background(), User{ID: "secret"})
+		ctx = n.WithMetadatum(ctx, "public", "key", "value")
+		return n.WithMetadatum(ctx, "private", "key", "value")
+	}
+	n, err := New(Configuration{
+		APIKey:                 "1234abcd1234abcd1234abcd1234abcd",
+		AppVersion:             "1.2.3",
+		ReleaseStage:           "test",
+		PropagatedMetadataTabs: []string{"public", "missing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	permissive, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		serializer   *Notifier
+		deserializer *Notifier
+	}{
+		{name: "serializing", serializer: n, deserializer: permissive},
+		{name: "deserializing", serializer: permissive, deserializer: n},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := makeCtx(tc.serializer)
+			cd := getAttachedContextData(tc.deserializer.Deserialize(context.Background(), tc.serializer.Serialize(ctx)))
+			if cd.User != nil {
+				t.Errorf("expected no user to be propagated but got %+v", cd.User)
+			}
+			if len(cd.Metadata) != 1 || cd.Metadata["public"]["key"] != "value" {
+				t.Errorf("expected only the public tab to be propagated but got %v", cd.Metadata)
+			}
+			if got := getAttachedContextData(ctx); got.User == nil || len(got.Metadata) != 2 {
+				t.Errorf("expected the serialized context to be unchanged but got %+v", got)
+			}
+		})
+	}
+}
+
+func TestSignedPropagation(t *testing.T) {
+	t.Parallel()
+	var (
+		oldKey   = []byte("old key")
+		newKey   = []byte("new key")
+		otherKey = []byte("other key")
+	)
+	makeNotifier := func(t *testing.T, keys ...[]byte) (*Notifier, func() []error) {
+		t.Helper()
+		var (
+			mu   sync.Mutex
+			errs []error
+		)
+		n, err := New(Configuration{
+			APIKey:                 "1234abcd1234abcd1234abcd1234abcd",
+			AppVersion:             "1.2.3",
+			ReleaseStage:           "test",
+			PropagationSigningKeys: keys,
+			InternalErrorCallback: func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n, func() []error {
+			mu.Lock()
+			defer mu.Unlock()
+			return errs
+		}
+	}
+	serialize := func(t *testing.T, keys ...[]byte) string {
+		t.Helper()
+		n, _ := makeNotifier(t, keys...)
+		return string(n.Serialize(n.WithBugsnagContext(context.Background(), "upstream")))
+	}
+
+	for _, tc := range []struct {
+		name           string
+		data           string
+		verifyingKeys  [][]byte
+		expBContext    string
+		expErrContains string
+	}{
+		{name: "signed with the current key", data: serialize(t, newKey), verifyingKeys: [][]byte{newKey, oldKey}, expBContext: "upstream"},
+		{name: "signed with a rotated key", data: serialize(t, oldKey), verifyingKeys: [][]byte{newKey, oldKey}, expBContext: "upstream"},
+		{name: "signed but no keys configured", data: serialize(t, otherKey), expBContext: "upstream"},
+		{name: "signed with an unknown key", data: serialize(t, otherKey), verifyingKeys: [][]byte{newKey, oldKey}, expErrContains: "invalid signature"},
+		{name: "unsigned", data: serialize(t), verifyingKeys: [][]byte{newKey}, expErrContains: "unsigned"},
+		{
+			name:           "legacy format",
+			data:           base64.StdEncoding.EncodeToString([]byte(`{"cx":"upstream"}`)),
+			verifyingKeys:  [][]byte{newKey},
+			expErrContains: "unsigned",
+		},
+		{
+			name:           "tampered payload",
+			data:           strings.Replace(serialize(t, newKey), "v1.j.", "v1.j.e30", 1),
+			verifyingKeys:  [][]byte{newKey},
+			expErrContains: "invalid signature",
+		},
+		{
+			name:           "malformed signature",
+			data:           serialize(t, newKey) + "!",
+			verifyingKeys:  [][]byte{newKey},
+			expErrContains: "malformed signature",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			n, errs := makeNotifier(t, tc.verifyingKeys...)
+			ctx := n.WithBugsnagContext(context.Background(), "local")
+			got := getAttachedContextData(n.Deserialize(ctx, []byte(tc.data))).BContext
+
+			if tc.expErrContains == "" {
+				if got != tc.expBContext {
+					t.Errorf("expected context '%s' but got '%s'", tc.expBContext, got)
+				}
+				if e := errs(); len(e) != 0 {
+					t.Errorf("expected no errors but got %v", e)
+				}
+				return
+			}
+			if got != "local" {
+				t.Errorf("expected rejected data to leave the context unchanged but got '%s'", got)
+			}
+			if e := errs(); len(e) != 1 || !strings.Contains(e[0].Error(), tc.expErrContains) {
+				t.Errorf("expected an error containing '%s' but got %v", tc.expErrContains, e)
+			}
+		})
+	}
+}
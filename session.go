@@ -9,13 +9,64 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
 type session struct {
-	ID          string
-	StartedAt   time.Time
-	EventCounts *JSONSessionEvents
+	ID        string
+	StartedAt time.Time
+
+	// eventCounts holds the number of handled events in its upper 32 bits,
+	// and the number of unhandled events in its lower 32 bits, such that both
+	// counts can be updated and read in a single atomic operation, which is
+	// needed as sessions are shared between goroutines.
+	eventCounts atomic.Uint64
+
+	state atomic.Int32
+
+	// group holds the attributes of the app and device that the session is
+	// published with.
+	group sessionGroup
+	skip  bool
+}
+
+// sessionGroup is the set of app and device attributes that sessions are
+// aggregated by, as each session report only has a single app and device.
+type sessionGroup struct {
+	appVersion   string
+	releaseStage string
+	appType      string
+	hostname     string
+}
+
+const (
+	sessionActive int32 = iota
+	sessionPaused
+	sessionEnded
+)
+
+const (
+	handledEvent   = 1 << 32
+	unhandledEvent = 1
+)
+
+// incrementEventCount atomically increments the handled or unhandled count of
+// events in this session, returning the counts including this event.
+func (s *session) incrementEventCount(unhandled bool) *JSONSessionEvents {
+	delta := uint64(handledEvent)
+	if unhandled {
+		delta = unhandledEvent
+	}
+	return makeJSONSessionEvents(s.eventCounts.Add(delta))
+}
+
+func makeJSONSessionEvents(counts uint64) *JSONSessionEvents {
+	return &JSONSessionEvents{
+		Handled:   int(counts >> 32),
+		Unhandled: int(counts & (handledEvent - 1)),
+	}
 }
 
 // SessionReportSanitizer allows you to modify the payload being sent to Bugsnag just before it's being sent.
@@ -24,41 +75,245 @@ type session struct {
 // No further modifications will happen to the payload after this is run.
 type SessionReportSanitizer func(p *JSONSessionReport) error
 
+// SessionStartSanitizer allows you to inspect and modify each session started
+// with StartSession before it is aggregated into a session report, e.g. in
+// order to publish the sessions of different tenants under different app
+// types. The ctx param provided will be the ctx given to StartSession, or
+// context.Background() for the session started by SessionPerProcess.
+// You may return a non-nil error in order to prevent the session from being
+// counted at all. This error is then forwarded to the InternalErrorCallback.
+type SessionStartSanitizer func(ctx context.Context, s *SessionStart) error
+
+// SessionStart describes a session as it's being started, including the
+// attributes of the app and device that the session is published with.
+type SessionStart struct {
+	ID        string
+	StartedAt time.Time
+
+	AppVersion   string
+	ReleaseStage string
+	AppType      string
+	Hostname     string
+}
+
+// propagatedSession identifies a session started by another service.
+type propagatedSession struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"sa"`
+}
+
+// SessionOption configures the session started with StartSession.
+type SessionOption func(*session)
+
+// WithSessionID returns a SessionOption that sets the ID of the session,
+// rather than generating a random ID.
+func WithSessionID(id string) SessionOption {
+	return func(s *session) { s.ID = id }
+}
+
+// WithSessionStartedAt returns a SessionOption that sets the time the session
+// started, rather than using the current time.
+func WithSessionStartedAt(startedAt time.Time) SessionOption {
+	return func(s *session) { s.StartedAt = startedAt }
+}
+
+// WithSessionApp returns a SessionOption that overrides the version, release
+// stage and type of the app that the session is published with, for any of
+// these that are non-empty. Sessions are published in separate session
+// reports per app and device.
+func WithSessionApp(version, releaseStage, appType string) SessionOption {
+	return func(s *session) {
+		if version != "" {
+			s.group.appVersion = version
+		}
+		if releaseStage != "" {
+			s.group.releaseStage = releaseStage
+		}
+		if appType != "" {
+			s.group.appType = appType
+		}
+	}
+}
+
+// WithSessionHostname returns a SessionOption that overrides the hostname of
+// the device that the session is published with.
+func WithSessionHostname(hostname string) SessionOption {
+	return func(s *session) { s.group.hostname = hostname }
+}
+
+// SkipSession returns a SessionOption that prevents the session from being
+// counted, e.g. for health check requests. Errors reported with the context
+// returned from StartSession don't count towards any session.
+func SkipSession() SessionOption {
+	return func(s *session) { s.skip = true }
+}
+
 // StartSession attaches Bugsnag session data to a copy of the given
 // context.Context, and returns the new context.Context.
 // Records the newly started session and will at some point flush this session.
-func (n *Notifier) StartSession(ctx context.Context) context.Context {
+// The session is passed to Configuration.SessionStartSanitizer, if set, once
+// the given options have been applied.
+// No session is recorded if the release stage isn't one of the
+// EnabledReleaseStages.
+func (n *Notifier) StartSession(ctx context.Context, opts ...SessionOption) context.Context {
 	// Ideally we wouldn't need this guard, but it's the best way I can see to
 	// prevent this package from ever panicking.
 	defer n.guard("StartSession")
 
+	return context.WithValue(ctx, sessionKey, n.startSession(ctx, opts...))
+}
+
+// startSession records and returns a newly started session. Skipped sessions,
+// and sessions started in release stages that aren't enabled, are returned as
+// ended sessions, such that no events count towards them.
+func (n *Notifier) startSession(ctx context.Context, opts ...SessionOption) *session {
 	n.loopOnce.Do(func() { go n.loop() })
 	session := &session{
-		StartedAt:   time.Now(),
-		ID:          uuidv4(),
-		EventCounts: &JSONSessionEvents{Handled: 0, Unhandled: 0},
+		StartedAt: time.Now(),
+		ID:        uuidv4(),
+		group: sessionGroup{
+			appVersion:   n.cfg.AppVersion,
+			releaseStage: n.cfg.ReleaseStage,
+			hostname:     n.cfg.hostname,
+		},
+	}
+	for _, opt := range opts {
+		opt(session)
+	}
+	enabled := n.cfg.releaseStageEnabled()
+	if !session.skip && (enabled || n.cfg.SanitizeDisabledReleaseStages) {
+		n.sanitizeSession(ctx, session)
+	}
+	if session.skip || !enabled {
+		session.state.Store(sessionEnded)
+		return session
 	}
 	n.sessionCh <- session
-	return context.WithValue(ctx, sessionKey, session)
+	return session
 }
 
-func (n *Notifier) flushSessions() {
-	sessions := n.sessions
-	n.sessions = nil
-	if len(sessions) == 0 {
+// sanitizeSession applies the SessionStartSanitizer to the given session,
+// marking it as skipped if the sanitizer returns an error.
+func (n *Notifier) sanitizeSession(ctx context.Context, sess *session) {
+	start := &SessionStart{
+		ID:           sess.ID,
+		StartedAt:    sess.StartedAt,
+		AppVersion:   sess.group.appVersion,
+		ReleaseStage: sess.group.releaseStage,
+		AppType:      sess.group.appType,
+		Hostname:     sess.group.hostname,
+	}
+	if err := n.cfg.SessionStartSanitizer(ctx, start); err != nil {
+		n.cfg.InternalErrorCallback(err)
+		sess.skip = true
 		return
 	}
+	sess.ID, sess.StartedAt = start.ID, start.StartedAt
+	sess.group = sessionGroup{
+		appVersion:   start.AppVersion,
+		releaseStage: start.ReleaseStage,
+		appType:      start.AppType,
+		hostname:     start.Hostname,
+	}
+}
+
+// PauseSession pauses the session attached to the given context, if any, such
+// that errors reported while the session is paused don't count towards the
+// session, and therefore don't affect your stability score. This is useful
+// for long-lived contexts, e.g. websocket connections or background jobs,
+// that are idle for long periods of time.
+// The session is paused for all contexts that share the session.
+func (n *Notifier) PauseSession(ctx context.Context) {
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	if sess := getSession(ctx); sess != nil {
+		sess.state.CompareAndSwap(sessionActive, sessionPaused)
+	}
+}
+
+// ResumeSession resumes the session attached to the given context, if it has
+// been paused with PauseSession, and returns the given context.
+// If the given context has no session, or the session has been ended with
+// EndSession, a new session is started as if by StartSession, and a copy of
+// the given context with the new session attached is returned.
+func (n *Notifier) ResumeSession(ctx context.Context) context.Context {
+	sess := getSession(ctx)
+	if sess == nil {
+		return n.StartSession(ctx)
+	}
+	sess.state.CompareAndSwap(sessionPaused, sessionActive)
+	if sess.state.Load() == sessionEnded {
+		return n.StartSession(ctx)
+	}
+	return ctx
+}
 
-	if err := n.publishSessions(n.cfg, sessions); err != nil {
-		n.cfg.InternalErrorCallback(fmt.Errorf("unable to publish sessions: %w", err))
+// EndSession ends the session attached to the given context, if any, such
+// that errors reported with the context no longer count towards the session.
+// Unlike paused sessions, ended sessions can't be resumed.
+func (n *Notifier) EndSession(ctx context.Context) {
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	if sess := getSession(ctx); sess != nil {
+		sess.state.Store(sessionEnded)
 	}
 }
 
-func (n *Notifier) publishSessions(cfg *Configuration, sessions []*session) error {
-	report := n.makeJSONSessionReport(cfg, sessions)
+// sessionCounts counts the sessions started in each minute, such that only
+// these counts, rather than every session, are held in memory until the
+// sessions are published.
+type sessionCounts struct {
+	perMinute map[time.Time]int
+	total     int
+}
+
+func (c *sessionCounts) add(startedAt time.Time) {
+	if c.perMinute == nil {
+		c.perMinute = map[time.Time]int{}
+	}
+	c.perMinute[startedAt.UTC().Truncate(time.Minute)]++
+	c.total++
+}
+
+// sessionGroups holds the session counts of each group of sessions.
+type sessionGroups struct {
+	counts map[sessionGroup]*sessionCounts
+	total  int
+}
+
+func (g *sessionGroups) add(sess *session) {
+	if g.counts == nil {
+		g.counts = map[sessionGroup]*sessionCounts{}
+	}
+	if g.counts[sess.group] == nil {
+		g.counts[sess.group] = &sessionCounts{}
+	}
+	g.counts[sess.group].add(sess.StartedAt)
+	g.total++
+}
+
+func (n *Notifier) flushSessions() {
+	groups := n.sessions
+	n.sessions = &sessionGroups{}
+	for group, sessions := range groups.counts {
+		if err := n.publishSessions(n.cfg, group, sessions); err != nil {
+			n.cfg.InternalErrorCallback(fmt.Errorf("unable to publish sessions: %w", err))
+		}
+	}
+}
+
+func (n *Notifier) publishSessions(cfg *Configuration, group sessionGroup, sessions *sessionCounts) error {
+	report := n.makeJSONSessionReport(cfg, group, sessions)
 	if err := n.cfg.SessionReportSanitizer(report); err != nil {
 		return err
 	}
+	if cfg.DryRunWriter != nil {
+		return writePayload(cfg.DryRunWriter, report)
+	}
 	payload, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("unable to marshal json: %w", err)
@@ -84,52 +339,66 @@ func (n *Notifier) publishSessions(cfg *Configuration, sessions []*session) erro
 	return nil
 }
 
-func incrementEventCountAndGetSession(ctx context.Context, unhandled bool) *session {
-	s := ctx.Value(sessionKey)
-	if s == nil {
-		return nil
-	}
-	session, ok := s.(*session)
-	if !ok {
-		return nil
+func getSession(ctx context.Context) *session {
+	if s, ok := ctx.Value(sessionKey).(*session); ok {
+		return s
 	}
+	return nil
+}
 
-	if unhandled {
-		session.EventCounts.Unhandled++
-	} else {
-		session.EventCounts.Handled++
+// sessionOf returns the session attached to the given context, falling back
+// to the session of the process if SessionPerProcess is configured.
+func (n *Notifier) sessionOf(ctx context.Context) *session {
+	if s := getSession(ctx); s != nil {
+		return s
 	}
-	return session
+	return n.processSession
 }
 
-func makeJSONSession(ctx context.Context, unhandled bool) *JSONSession {
-	if sess := incrementEventCountAndGetSession(ctx, unhandled); sess != nil {
-		return &JSONSession{
-			ID:        sess.ID,
-			StartedAt: sess.StartedAt.Format(time.RFC3339),
-			Events: &JSONSessionEvents{
-				Handled:   sess.EventCounts.Handled,
-				Unhandled: sess.EventCounts.Unhandled,
-			},
-		}
+// makeJSONSession counts an event against the given session, if any, and
+// returns the session as of this event. Events don't count towards paused or
+// ended sessions.
+func makeJSONSession(sess *session, unhandled bool) *JSONSession {
+	if sess == nil || sess.state.Load() != sessionActive {
+		return nil
+	}
+	return &JSONSession{
+		ID:        sess.ID,
+		StartedAt: sess.StartedAt.Format(time.RFC3339),
+		Events:    sess.incrementEventCount(unhandled),
 	}
-	return nil
 }
 
-func (n *Notifier) makeJSONSessionReport(cfg *Configuration, sessions []*session) *JSONSessionReport {
+func (n *Notifier) makeJSONSessionReport(cfg *Configuration, group sessionGroup, sessions *sessionCounts) *JSONSessionReport {
+	app := makeJSONApp(cfg)
+	app.Version, app.ReleaseStage, app.Type = group.appVersion, group.releaseStage, group.appType
+	device := n.makeJSONDevice()
+	device.Hostname = group.hostname
 	return &JSONSessionReport{
-		Notifier: makeNotifier(cfg),
-		App:      makeJSONApp(cfg),
-		Device:   n.makeJSONDevice(),
-		SessionCounts: []JSONSessionCounts{
-			{
-				// This timestamp assumes that the sessions happen at more or
-				// less the same point in time
-				StartedAt:       sessions[0].StartedAt.UTC().Format(time.RFC3339),
-				SessionsStarted: len(sessions),
-			},
-		},
+		Notifier:      makeNotifier(cfg),
+		App:           app,
+		Device:        device,
+		SessionCounts: makeSessionCounts(sessions),
+	}
+}
+
+// makeSessionCounts returns one entry per minute in which sessions were
+// started, ordered chronologically, as expected by the Session Tracking API.
+func makeSessionCounts(sessions *sessionCounts) []JSONSessionCounts {
+	minutes := make([]time.Time, 0, len(sessions.perMinute))
+	for minute := range sessions.perMinute {
+		minutes = append(minutes, minute)
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i].Before(minutes[j]) })
+
+	sessionCounts := make([]JSONSessionCounts, len(minutes))
+	for i, minute := range minutes {
+		sessionCounts[i] = JSONSessionCounts{
+			StartedAt:       minute.Format(time.RFC3339),
+			SessionsStarted: sessions.perMinute[minute],
+		}
 	}
+	return sessionCounts
 }
 
 // uuidv4 returns a randomly generated UUID v4.
@@ -2,9 +2,16 @@ package bugsnag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,6 +55,8 @@ func TestSessions(t *testing.T) {
 		APIKey:           apiKey,
 		AppVersion:       "3.5.1",
 		ReleaseStage:     "staging",
+
+		SessionPublishInterval: time.Microsecond, // Just to make things go a bit faster,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -59,7 +68,6 @@ func TestSessions(t *testing.T) {
 		osName:          "linux innit",
 		notifierVersion: "0.1.0",
 	}
-	n.sessionPublishInterval = time.Microsecond // Just to make things go a bit faster,
 	n.StartSession(context.Background())
 
 	jsonassert.New(t).Assertf(<-payloads, `{
@@ -87,23 +95,396 @@ func TestSessionAndContext(t *testing.T) {
 				t.Fatal(err)
 			}
 			ctx := n.StartSession(context.Background())
-			s := incrementEventCountAndGetSession(ctx, tc.unhandled)
+			s := makeJSONSession(getSession(ctx), tc.unhandled)
+			if s == nil {
+				t.Fatal("expected a session but got none")
+			}
 			if got := len(s.ID); got == 0 {
 				t.Error("expected session ID to be set but was empty")
 			}
-			if got := s.StartedAt; got.IsZero() {
+			if got := s.StartedAt; got == "" {
 				t.Error("expected session StartedAt to be set but was empty")
 			}
-			got := s.EventCounts
+			got := s.Events
 			if got == nil {
-				t.Fatal("expected EventCounts to be set but wasn't")
+				t.Fatal("expected Events to be set but wasn't")
 			}
-			if got := s.EventCounts.Unhandled; got != tc.expUnhandledCount {
-				t.Errorf("expected EventCounts.Unhandled to be %d but %d", tc.expUnhandledCount, got)
+			if got := s.Events.Unhandled; got != tc.expUnhandledCount {
+				t.Errorf("expected Events.Unhandled to be %d but %d", tc.expUnhandledCount, got)
 			}
-			if got := s.EventCounts.Handled; got != tc.expHandledCount {
-				t.Errorf("expected EventCounts.Handled to be %d but %d", tc.expHandledCount, got)
+			if got := s.Events.Handled; got != tc.expHandledCount {
+				t.Errorf("expected Events.Handled to be %d but %d", tc.expHandledCount, got)
 			}
 		})
 	}
 }
+
+func TestMakeSessionCounts(t *testing.T) {
+	t.Parallel()
+	minute := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+	at := func(offset time.Duration) time.Time { return minute.Add(offset) }
+
+	for _, tc := range []struct {
+		name     string
+		sessions []time.Time
+		exp      string
+	}{
+		{
+			name:     "single minute",
+			sessions: []time.Time{at(0), at(30 * time.Second), at(59 * time.Second)},
+			exp:      `[{ "startedAt": "2024-06-01T12:30:00Z", "sessionsStarted": 3 }]`,
+		},
+		{
+			name: "across minutes, out of order",
+			sessions: []time.Time{
+				at(2*time.Minute + time.Second),
+				at(10 * time.Second),
+				at(time.Minute),
+				at(2 * time.Minute),
+				at(20 * time.Second),
+			},
+			exp: `[
+				{ "startedAt": "2024-06-01T12:30:00Z", "sessionsStarted": 2 },
+				{ "startedAt": "2024-06-01T12:31:00Z", "sessionsStarted": 1 },
+				{ "startedAt": "2024-06-01T12:32:00Z", "sessionsStarted": 2 }
+			]`,
+		},
+		{
+			name:     "non-UTC time zones",
+			sessions: []time.Time{minute.In(time.FixedZone("JST", 9*60*60)).Add(5 * time.Second), at(0)},
+			exp:      `[{ "startedAt": "2024-06-01T12:30:00Z", "sessionsStarted": 2 }]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			counts := &sessionCounts{}
+			for _, startedAt := range tc.sessions {
+				counts.add(startedAt)
+			}
+			if counts.total != len(tc.sessions) {
+				t.Errorf("expected a total of %d sessions but got %d", len(tc.sessions), counts.total)
+			}
+			b, err := json.Marshal(makeSessionCounts(counts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			jsonassert.New(t).Assertf(string(b), tc.exp)
+		})
+	}
+}
+
+func TestMaxSessionsPerPayload(t *testing.T) {
+	t.Parallel()
+	payloads := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payloads <- string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	n, err := New(Configuration{
+		EndpointSessions:       ts.URL,
+		EndpointNotify:         ts.URL,
+		APIKey:                 "abcd1234abcd1234abcd1234abcd1234",
+		AppVersion:             "3.5.1",
+		ReleaseStage:           "staging",
+		SessionPublishInterval: time.Hour,
+		MaxSessionsPerPayload:  3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		n.StartSession(context.Background())
+	}
+
+	select {
+	case got := <-payloads:
+		jsonassert.New(t).Assertf(got, `{
+			"notifier": "<<PRESENCE>>",
+			"app": "<<PRESENCE>>",
+			"device": "<<PRESENCE>>",
+			"sessionCounts": [{ "startedAt": "<<PRESENCE>>", "sessionsStarted": 3 }]
+		}`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected sessions to be published early but they weren't")
+	}
+
+	n.Close()
+	if got := <-payloads; !strings.Contains(got, `"sessionsStarted":1`) {
+		t.Errorf("expected the remaining session to be published on Close but got %s", got)
+	}
+}
+
+func TestConcurrentSessionEventCounts(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage: "dev",
+		AppVersion:   "1.2.3",
+		ErrorReportSanitizer: func(_ context.Context, _ *JSONErrorReport) error {
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+		SessionReportSanitizer: func(_ *JSONSessionReport) error {
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	ctx := n.StartSession(context.Background())
+	const goroutines = 50
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		snapshots []*JSONSessionEvents
+	)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(unhandled bool) {
+			defer wg.Done()
+			// Wrapping with the same session must only count the event once.
+			var opts []interface{}
+			if unhandled {
+				opts = append(opts, AsUnhandled())
+			}
+			report, _ := n.makeReport(ctx, Wrap(ctx, errors.New("oops"), opts...))
+			n.Notify(ctx, errors.New("oops"))
+
+			mu.Lock()
+			defer mu.Unlock()
+			snapshots = append(snapshots, report.Events[0].Session.Events)
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	exp := &JSONSessionEvents{Handled: goroutines + goroutines/2, Unhandled: goroutines / 2}
+	if got := makeJSONSessionEvents(getSession(ctx).eventCounts.Load()); *got != *exp {
+		t.Errorf("expected event counts %+v but got %+v", exp, got)
+	}
+	// Each event sees a distinct, consistent, snapshot of the counts.
+	seen := map[JSONSessionEvents]bool{}
+	for _, s := range snapshots {
+		if seen[*s] {
+			t.Errorf("expected distinct snapshots but got %+v twice", s)
+		}
+		seen[*s] = true
+		if s.Handled+s.Unhandled > 2*goroutines {
+			t.Errorf("got impossible snapshot %+v", s)
+		}
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	t.Parallel()
+	n, err := New(Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage: "dev",
+		AppVersion:   "1.2.3",
+		SessionReportSanitizer: func(_ *JSONSessionReport) error {
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+	sessionOf := func(ctx context.Context) *JSONSession {
+		report, _ := n.makeReport(ctx, errors.New("oops"))
+		return report.Events[0].Session
+	}
+
+	t.Run("explicit ID and start time", func(t *testing.T) {
+		t.Parallel()
+		startedAt := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+		ctx := n.StartSession(context.Background(), WithSessionID("my-session"), WithSessionStartedAt(startedAt))
+		if got := sessionOf(ctx); got.ID != "my-session" || got.StartedAt != "2024-06-01T12:30:00Z" {
+			t.Errorf("expected the given ID and start time but got %+v", got)
+		}
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.StartSession(context.Background())
+		derived := n.WithBugsnagContext(ctx, "derived")
+		id := sessionOf(ctx).ID
+
+		n.PauseSession(ctx)
+		if got := sessionOf(derived); got != nil {
+			t.Errorf("expected no session while paused but got %+v", got)
+		}
+		if got := n.ResumeSession(ctx); got != ctx {
+			t.Error("expected resuming a paused session to return the given context")
+		}
+		if got := sessionOf(derived); got == nil || got.ID != id || got.Events.Handled != 2 {
+			t.Errorf("expected the resumed session to count events again but got %+v", got)
+		}
+	})
+
+	t.Run("end", func(t *testing.T) {
+		t.Parallel()
+		ctx := n.StartSession(context.Background())
+		id := sessionOf(ctx).ID
+
+		n.EndSession(ctx)
+		if got := sessionOf(ctx); got != nil {
+			t.Errorf("expected no session once ended but got %+v", got)
+		}
+		ctx = n.ResumeSession(ctx)
+		if got := sessionOf(ctx); got == nil || got.ID == id {
+			t.Errorf("expected resuming an ended session to start a new session but got %+v", got)
+		}
+	})
+
+	t.Run("resume without session", func(t *testing.T) {
+		t.Parallel()
+		if got := sessionOf(n.ResumeSession(context.Background())); got == nil {
+			t.Error("expected a new session to be started but there was none")
+		}
+	})
+
+	t.Run("propagation", func(t *testing.T) {
+		t.Parallel()
+		upstream := n.StartSession(context.Background())
+		id := sessionOf(upstream).ID
+
+		downstream := n.ResumeSession(n.Deserialize(context.Background(), n.Serialize(upstream)))
+		if got := sessionOf(downstream); got == nil || got.ID != id {
+			t.Errorf("expected the downstream context to continue the upstream session but got %+v", got)
+		}
+
+		local := n.StartSession(context.Background())
+		localID := sessionOf(local).ID
+		if got := sessionOf(n.Deserialize(local, n.Serialize(upstream), WithMerge())); got == nil || got.ID != localID {
+			t.Errorf("expected merging to keep the local session but got %+v", got)
+		}
+		if got := sessionOf(n.Deserialize(local, n.Serialize(upstream))); got == nil || got.ID != localID {
+			t.Errorf("expected a session started before deserializing to be kept but got %+v", got)
+		}
+
+		n.PauseSession(upstream)
+		if got := sessionOf(n.Deserialize(context.Background(), n.Serialize(upstream))); got != nil {
+			t.Errorf("expected paused sessions not to be propagated but got %+v", got)
+		}
+	})
+}
+
+func TestSessionPerProcess(t *testing.T) {
+	t.Parallel()
+	var published *JSONSessionReport
+	n, err := New(Configuration{
+		APIKey:            "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage:      "dev",
+		AppVersion:        "1.2.3",
+		SessionPerProcess: true,
+		SessionReportSanitizer: func(r *JSONSessionReport) error {
+			published = r
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionOf := func(ctx context.Context) *JSONSession {
+		report, _ := n.makeReport(ctx, errors.New("oops"))
+		return report.Events[0].Session
+	}
+
+	first, second := sessionOf(context.Background()), sessionOf(context.Background())
+	if first == nil || second == nil || first.ID != second.ID || second.Events.Handled != 2 {
+		t.Errorf("expected both events to count towards the process session but got %+v and %+v", first, second)
+	}
+	if got := sessionOf(n.StartSession(context.Background())); got == nil || got.ID == first.ID {
+		t.Errorf("expected the session attached to the context to take precedence but got %+v", got)
+	}
+
+	n.Close()
+	started := 0
+	for _, counts := range published.SessionCounts {
+		started += counts.SessionsStarted
+	}
+	if started != 2 {
+		t.Errorf("expected the process session and the started session to be published but got %d sessions", started)
+	}
+}
+
+func TestSessionStartOptionsAndSanitizer(t *testing.T) {
+	t.Parallel()
+	type tenantKey struct{}
+	var (
+		mu      sync.Mutex
+		reports []*JSONSessionReport
+		errs    []error
+	)
+	n, err := New(Configuration{
+		APIKey:       "abcd1234abcd1234abcd1234abcd1234",
+		ReleaseStage: "dev",
+		AppVersion:   "1.2.3",
+		SessionStartSanitizer: func(ctx context.Context, s *SessionStart) error {
+			switch tenant, _ := ctx.Value(tenantKey{}).(string); tenant {
+			case "":
+				return nil
+			case "health-check":
+				return errors.New("skip health checks")
+			default:
+				s.AppType = "tenant-" + tenant
+				return nil
+			}
+		},
+		SessionReportSanitizer: func(r *JSONSessionReport) error {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, r)
+			return errors.New("prevents sending the payload to Bugsnag")
+		},
+		InternalErrorCallback: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	n.StartSession(ctx)
+	n.StartSession(ctx, WithSessionApp("", "", "worker"), WithSessionHostname("worker-1"))
+	n.StartSession(ctx, WithSessionApp("2.0.0", "canary", ""))
+	n.StartSession(context.WithValue(ctx, tenantKey{}, "acme"))
+	n.StartSession(context.WithValue(ctx, tenantKey{}, "acme"))
+
+	for _, skipped := range []context.Context{
+		n.StartSession(ctx, SkipSession()),
+		n.StartSession(context.WithValue(ctx, tenantKey{}, "health-check")),
+	} {
+		if report, _ := n.makeReport(skipped, errors.New("oops")); report.Events[0].Session != nil {
+			t.Errorf("expected no session for skipped sessions but got %+v", report.Events[0].Session)
+		}
+	}
+	n.Close()
+
+	got := map[string]int{}
+	for _, r := range reports {
+		key := fmt.Sprintf("%s/%s/%s/%s", r.App.Version, r.App.ReleaseStage, r.App.Type, r.Device.Hostname)
+		for _, counts := range r.SessionCounts {
+			got[key] += counts.SessionsStarted
+		}
+	}
+	hostname, _ := os.Hostname()
+	exp := map[string]int{
+		"1.2.3/dev//" + hostname:            1,
+		"1.2.3/dev/worker/worker-1":         1,
+		"2.0.0/canary//" + hostname:         1,
+		"1.2.3/dev/tenant-acme/" + hostname: 2,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected sessions to be published per app and device as %v but got %v", exp, got)
+	}
+	if len(errs) != len(reports)+1 {
+		t.Errorf("expected the sanitizer error to be forwarded to the InternalErrorCallback but got %v", errs)
+	}
+}
@@ -0,0 +1,104 @@
+package bugsnag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraceExtractor returns the IDs of the trace and span that are active in the
+// given ctx, or empty strings if there are none. Configure one in order to
+// correlate error reports with traces from your tracing library of choice,
+// e.g. OpenTelemetry:
+//
+//	func(ctx context.Context) (string, string) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		if !sc.IsValid() {
+//			return "", ""
+//		}
+//		return sc.TraceID().String(), sc.SpanID().String()
+//	}
+type TraceExtractor func(ctx context.Context) (traceID, spanID string)
+
+// traceContext identifies the trace and span that a context belongs to.
+type traceContext struct {
+	traceID string
+	spanID  string
+}
+
+// WithTraceParent attaches the trace and span IDs of the given W3C
+// traceparent header value to the given context, such that errors reported
+// with this context can be correlated with the trace. Invalid values are
+// ignored, returning the given context as-is.
+// The IDs from the Configuration.TraceExtractor take precedence over these
+// IDs, if any.
+// These IDs are not propagated to other services via Serialize, as the
+// traceparent header is the standard way of doing so.
+func (n *Notifier) WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	// This function currently uses no features of the Notifier type, however
+	// we're attaching it to the Notifier to ensure that we can use
+	// Notifier-only functionalities in the future AND so that users need only
+	// import the bugsnag package in a single location in their app.
+	traceID, spanID, err := ParseTraceParent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	tc := &traceContext{traceID: traceID, spanID: spanID}
+	return withContextData(ctx, func(cd *ctxData) { cd.trace = tc })
+}
+
+// ParseTraceParent extracts the trace and span IDs from the given W3C
+// traceparent header value, as defined by
+// https://www.w3.org/TR/trace-context/#traceparent-header
+func ParseTraceParent(traceparent string) (traceID, spanID string, err error) {
+	fields := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(fields) < 4 {
+		return "", "", fmt.Errorf(`traceparent must have 4 fields, got "%s"`, traceparent)
+	}
+	version, traceID, spanID, flags := fields[0], fields[1], fields[2], fields[3]
+	switch {
+	case !isLowerHex(version, 2) || version == "ff":
+		return "", "", fmt.Errorf(`invalid traceparent version "%s"`, version)
+	case version == "00" && len(fields) != 4:
+		// Only later versions may append fields.
+		return "", "", fmt.Errorf(`traceparent version 00 must have 4 fields, got "%s"`, traceparent)
+	case !isLowerHex(traceID, 32) || strings.Trim(traceID, "0") == "":
+		return "", "", fmt.Errorf(`invalid traceparent trace ID "%s"`, traceID)
+	case !isLowerHex(spanID, 16) || strings.Trim(spanID, "0") == "":
+		return "", "", fmt.Errorf(`invalid traceparent parent ID "%s"`, spanID)
+	case !isLowerHex(flags, 2):
+		return "", "", errors.New("invalid traceparent flags")
+	}
+	return traceID, spanID, nil
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// makeCorrelation returns the IDs of the trace and span that the given ctx
+// belongs to, from the configured TraceExtractor, falling back to the IDs
+// attached with WithTraceParent.
+func (n *Notifier) makeCorrelation(ctx context.Context) *JSONCorrelation {
+	if n.cfg.TraceExtractor != nil {
+		if traceID, spanID := n.cfg.TraceExtractor(ctx); traceID != "" {
+			return &JSONCorrelation{TraceID: traceID, SpanID: spanID}
+		}
+	}
+	if tc := getAttachedContextData(ctx).trace; tc != nil {
+		return &JSONCorrelation{TraceID: tc.traceID, SpanID: tc.spanID}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bugsnag
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name        string
+		traceparent string
+		expTraceID  string
+		expSpanID   string
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"future version with extra fields", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-ever", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"empty", "", "", ""},
+		{"too few fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "", ""},
+		{"version 00 with extra fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", ""},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", ""},
+		{"uppercase trace ID", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", ""},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", ""},
+		{"short span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", "", ""},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", ""},
+		{"invalid flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x1", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			traceID, spanID, err := ParseTraceParent(tc.traceparent)
+			if tc.expTraceID == "" {
+				if err == nil {
+					t.Errorf("expected an error but got trace ID '%s' and span ID '%s'", traceID, spanID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if traceID != tc.expTraceID || spanID != tc.expSpanID {
+				t.Errorf("expected trace ID '%s' and span ID '%s' but got '%s' and '%s'", tc.expTraceID, tc.expSpanID, traceID, spanID)
+			}
+		})
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	t.Parallel()
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	makeNotifier := func(t *testing.T, extractor TraceExtractor) *Notifier {
+		t.Helper()
+		n, err := New(Configuration{APIKey: "1234abcd1234abcd1234abcd1234abcd", AppVersion: "1.2.3", ReleaseStage: "test", TraceExtractor: extractor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	t.Run("from traceparent", func(t *testing.T) {
+		t.Parallel()
+		n := makeNotifier(t, nil)
+		ctx := n.WithTraceParent(context.Background(), traceparent)
+		if got := n.WithTraceParent(ctx, "invalid"); got != ctx {
+			t.Error("expected invalid traceparent values to be ignored")
+		}
+
+		event := makeEvent(ctx, n)
+		if got := event.Correlation; got == nil || got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID != "00f067aa0ba902b7" {
+			t.Errorf("expected correlation from the traceparent but got %+v", got)
+		}
+		if got := event.Metadata["trace"]; got["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || got["spanId"] != "00f067aa0ba902b7" {
+			t.Errorf("expected trace metadata but got %v", got)
+		}
+	})
+
+	t.Run("extractor takes precedence", func(t *testing.T) {
+		t.Parallel()
+		n := makeNotifier(t, func(ctx context.Context) (string, string) {
+			if ctx.Value(ctxKey(-1)) == nil {
+				return "", ""
+			}
+			return "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+		})
+		ctx := n.WithTraceParent(context.Background(), traceparent)
+		if got := makeEvent(ctx, n).Correlation; got == nil || got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected to fall back to the traceparent but got %+v", got)
+		}
+		ctx = context.WithValue(ctx, ctxKey(-1), true)
+		if got := makeEvent(ctx, n).Correlation; got == nil || got.TraceID != "0af7651916cd43dd8448eb211c80319c" || got.SpanID != "b7ad6b7169203331" {
+			t.Errorf("expected correlation from the extractor but got %+v", got)
+		}
+	})
+
+	t.Run("no trace", func(t *testing.T) {
+		t.Parallel()
+		event := makeEvent(context.Background(), makeNotifier(t, nil))
+		if event.Correlation != nil || event.Metadata["trace"] != nil {
+			t.Errorf("expected no correlation but got %+v and %v", event.Correlation, event.Metadata)
+		}
+	})
+}
+
+func makeEvent(ctx context.Context, n *Notifier) *JSONEvent {
+	report, _ := n.makeReport(ctx, Wrap(ctx, errors.New("oops")))
+	return report.Events[0]
+}